@@ -0,0 +1,93 @@
+// Package authz decides what authenticated users may do, going by their role.
+package authz
+
+import (
+	"context"
+	"errors"
+	"fit-byte/usecases/user"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ROLE_USER  string = "USER"
+	ROLE_COACH string = "COACH"
+	ROLE_ADMIN string = "ADMIN"
+)
+
+type Permission string
+
+const (
+	ReadUsers         Permission = "users:read"
+	ManageUsers       Permission = "users:manage"
+	ReadAnyActivities Permission = "activities:read_any"
+)
+
+// rolePermissions only lists what goes beyond managing one's own data, which
+// every role can do.
+var rolePermissions = map[string][]Permission{
+	ROLE_USER:  {},
+	ROLE_COACH: {ReadUsers},
+	ROLE_ADMIN: {ReadUsers, ManageUsers, ReadAnyActivities},
+}
+
+func Can(role string, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+type contextKey struct{}
+
+type Authorizer struct {
+	userRepository user.UserRepository
+}
+
+func NewAuthorizer(userRepository user.UserRepository) *Authorizer {
+	return &Authorizer{userRepository}
+}
+
+// LoadRole looks the authenticated user up, turning away disabled or deleted
+// accounts, and keeps their role for RequirePermission. It must run after the
+// authenticator, and reads the role on every request so a change applies
+// right away.
+func (a *Authorizer) LoadRole(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, _ := jwtauth.FromContext(r.Context())
+		userId, _ := claims["userId"].(string)
+
+		currentUser, err := a.userRepository.FindById(userId)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Println("Error loading user role:", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if currentUser == nil || currentUser.DisabledAt.Valid {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, currentUser.Role)))
+	})
+}
+
+// RoleFromContext returns the role LoadRole found for the request.
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(contextKey{}).(string)
+	return role
+}
+
+func RequirePermission(permission Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !Can(RoleFromContext(r.Context()), permission) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+// Package background runs the periodic jobs of the api, like purging deleted
+// accounts, next to the http server.
+package background
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every calls fn right away and then every interval until ctx is done. Errors
+// are logged, the job runs again at the next tick.
+func Every(ctx context.Context, name string, interval time.Duration, fn func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fn(); err != nil {
+			log.Printf("Error running %s: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,11 +1,57 @@
 package constants
 
+import "time"
+
 const (
-	SALT_ROUND int = 10
-	JWT_SECRET string = "secret"
-	HASH_ALG string = "HS256"
+	ACCESS_TOKEN_TTL time.Duration = 24 * time.Hour
 
 	UNIQUE_VIOLATION_ERROR_CODE string = "23505"
 	FOREIGN_KEY_CONSTRAINT_VIOLATION_ERROR_CODE string = "23503"
 	INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE string = "22P02"
+
+	TOKEN_PURPOSE_PASSWORD_RESET string = "password_reset"
+	TOKEN_PURPOSE_EMAIL_VERIFICATION string = "email_verification"
+	PASSWORD_RESET_TOKEN_TTL time.Duration = time.Hour
+	EMAIL_VERIFICATION_TOKEN_TTL time.Duration = 48 * time.Hour
+	TOKEN_PURPOSE_EMAIL_CHANGE string = "email_change"
+	EMAIL_CHANGE_TOKEN_TTL time.Duration = 24 * time.Hour
+
+	LOGIN_ACCOUNT_MAX_FAILURES int = 5
+	LOGIN_IP_MAX_FAILURES int = 20
+	LOGIN_FAILURE_WINDOW time.Duration = 24 * time.Hour
+	LOGIN_LOCKOUT_BASE time.Duration = time.Minute
+	LOGIN_LOCKOUT_MAX time.Duration = time.Hour
+
+	TOKEN_PURPOSE_TWO_FACTOR_CHALLENGE string = "two_factor_challenge"
+	TWO_FACTOR_CHALLENGE_TTL time.Duration = 5 * time.Minute
+	TWO_FACTOR_ISSUER string = "FitByte"
+	RECOVERY_CODE_COUNT int = 10
+
+	ACCESS_TOKEN_PREFIX string = "fbp_"
+	SCOPE_ACTIVITY_READ string = "activity:read"
+	SCOPE_ACTIVITY_WRITE string = "activity:write"
+	SCOPE_PROFILE_READ string = "profile:read"
+	SCOPE_PROFILE_WRITE string = "profile:write"
+
+	ACCOUNT_DELETION_GRACE_PERIOD time.Duration = 30 * 24 * time.Hour
+	DATA_EXPORT_TTL time.Duration = 7 * 24 * time.Hour
+	DATA_EXPORT_DOWNLOAD_URL_TTL time.Duration = 15 * time.Minute
+
+	ACTIVITY_REVISION_CREATE string = "CREATE"
+	ACTIVITY_REVISION_UPDATE string = "UPDATE"
+	ACTIVITY_REVISION_DELETE string = "DELETE"
+	ACTIVITY_REVISION_RESTORE string = "RESTORE"
+	ACTIVITY_TRASH_RETENTION time.Duration = 30 * 24 * time.Hour
+	ACTIVITY_BATCH_MAX_SIZE int = 100
+	ACTIVITY_EXPORT_FLUSH_EVERY int = 100
+	ACTIVITY_IMPORT_MAX_ROWS int = 10000
+	BATCH_MODE_ATOMIC string = "ATOMIC"
+	BATCH_MODE_PARTIAL string = "PARTIAL"
+
+	HISTORY_SOURCE_APPLE_HEALTH string = "APPLE_HEALTH"
+	HISTORY_SOURCE_GOOGLE_TAKEOUT string = "GOOGLE_TAKEOUT"
+	HISTORY_IMPORT_MAX_ERRORS int = 1000
+
+	IDEMPOTENCY_KEY_TTL time.Duration = 24 * time.Hour
+	IDEMPOTENCY_LOCK_TIMEOUT time.Duration = time.Minute
 )
\ No newline at end of file
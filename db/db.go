@@ -6,7 +6,10 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -37,7 +40,14 @@ func GetPostgresConnection(connString string) (*pgxpool.Pool, error) {
 	var err error
 
 	pgOnce.Do(func() {
-		pgConn, err = pgxpool.New(context.Background(), connString)
+		var config *pgxpool.Config
+		config, err = pgxpool.ParseConfig(connString)
+		if err != nil {
+			log.Fatal("Error to parse postgres connection string:", err)
+		}
+		config.AfterConnect = scanTimestamptzAsUTC
+
+		pgConn, err = pgxpool.NewWithConfig(context.Background(), config)
 		if err != nil {
 			log.Fatal("Error to create postgres database connection:", err)
 		}
@@ -54,6 +64,18 @@ func GetPostgresConnection(connString string) (*pgxpool.Pool, error) {
 	return pgConn, err
 }
 
+// scanTimestamptzAsUTC makes timestamptz values come back in UTC instead of
+// the server's local time zone, so they serialize the same everywhere.
+func scanTimestamptzAsUTC(ctx context.Context, conn *pgx.Conn) error {
+	conn.TypeMap().RegisterType(&pgtype.Type{
+		Name:  "timestamptz",
+		OID:   pgtype.TimestamptzOID,
+		Codec: &pgtype.TimestamptzCodec{ScanLocation: time.UTC},
+	})
+
+	return nil
+}
+
 func Setup(ctx context.Context) *pgxpool.Pool {
 	log.SetPrefix("DB: ")
 
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX activities_user_id_done_at_idx;
+
+ALTER TABLE activities DROP COLUMN user_id;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- activities weren't tied to a user before, those are left without one until
+-- db/scripts/assign_activities.sql gives them an owner, see migration 000026
+ALTER TABLE activities
+    ADD COLUMN user_id uuid REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX activities_user_id_done_at_idx ON activities (user_id, done_at);
+
+COMMIT;
\ No newline at end of file
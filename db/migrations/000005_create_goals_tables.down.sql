@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE goal_periods;
+DROP TABLE goals;
+DROP TYPE goal_period;
+DROP TYPE goal_metric;
+
+COMMIT;
\ No newline at end of file
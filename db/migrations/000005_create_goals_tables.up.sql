@@ -0,0 +1,32 @@
+BEGIN;
+
+CREATE TYPE goal_metric AS ENUM ('ACTIVE_MINUTES', 'CALORIES_BURNED', 'ACTIVITY_COUNT');
+CREATE TYPE goal_period AS ENUM ('DAY', 'WEEK', 'MONTH');
+
+CREATE TABLE goals (
+    id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id         uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name            text,
+    metric          goal_metric NOT NULL,
+    period          goal_period NOT NULL,
+    target          integer NOT NULL,
+    activity_type   activity_type,
+    created_at      timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX goals_user_id_idx ON goals (user_id);
+
+CREATE TABLE goal_periods (
+    id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    goal_id         uuid NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+    period_start    timestamp NOT NULL,
+    period_end      timestamp NOT NULL,
+    target          integer NOT NULL,
+    achieved        integer NOT NULL,
+    completed       boolean NOT NULL,
+    recorded_at     timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (goal_id, period_start)
+);
+
+COMMIT;
\ No newline at end of file
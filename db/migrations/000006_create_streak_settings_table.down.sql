@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE streak_settings;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,10 @@
+BEGIN;
+
+CREATE TABLE streak_settings (
+    user_id             uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    rest_days_per_week  integer NOT NULL DEFAULT 0,
+    weekly_active_days  integer NOT NULL DEFAULT 1,
+    updated_at          timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMIT;
\ No newline at end of file
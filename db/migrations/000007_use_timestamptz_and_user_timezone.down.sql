@@ -0,0 +1,23 @@
+BEGIN;
+
+ALTER TABLE users
+    DROP COLUMN timezone;
+
+ALTER TABLE streak_settings
+    ALTER COLUMN updated_at TYPE timestamp USING updated_at AT TIME ZONE 'UTC';
+
+ALTER TABLE goal_periods
+    ALTER COLUMN period_start TYPE timestamp USING period_start AT TIME ZONE 'UTC',
+    ALTER COLUMN period_end TYPE timestamp USING period_end AT TIME ZONE 'UTC',
+    ALTER COLUMN recorded_at TYPE timestamp USING recorded_at AT TIME ZONE 'UTC';
+
+ALTER TABLE goals
+    ALTER COLUMN created_at TYPE timestamp USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN updated_at TYPE timestamp USING updated_at AT TIME ZONE 'UTC';
+
+ALTER TABLE activities
+    ALTER COLUMN done_at TYPE timestamp USING done_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at TYPE timestamp USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN updated_at TYPE timestamp USING updated_at AT TIME ZONE 'UTC';
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,24 @@
+BEGIN;
+
+-- existing values were written as UTC wall-clock times
+ALTER TABLE activities
+    ALTER COLUMN done_at TYPE timestamptz USING done_at AT TIME ZONE 'UTC',
+    ALTER COLUMN created_at TYPE timestamptz USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN updated_at TYPE timestamptz USING updated_at AT TIME ZONE 'UTC';
+
+ALTER TABLE goals
+    ALTER COLUMN created_at TYPE timestamptz USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN updated_at TYPE timestamptz USING updated_at AT TIME ZONE 'UTC';
+
+ALTER TABLE goal_periods
+    ALTER COLUMN period_start TYPE timestamptz USING period_start AT TIME ZONE 'UTC',
+    ALTER COLUMN period_end TYPE timestamptz USING period_end AT TIME ZONE 'UTC',
+    ALTER COLUMN recorded_at TYPE timestamptz USING recorded_at AT TIME ZONE 'UTC';
+
+ALTER TABLE streak_settings
+    ALTER COLUMN updated_at TYPE timestamptz USING updated_at AT TIME ZONE 'UTC';
+
+ALTER TABLE users
+    ADD COLUMN timezone text NOT NULL DEFAULT 'UTC';
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,12 @@
+BEGIN;
+
+COMMENT ON COLUMN users.weight IS NULL;
+COMMENT ON COLUMN users.height IS NULL;
+
+ALTER TABLE users
+    ALTER COLUMN weight TYPE integer USING
+        round(CASE WHEN weight_unit = 'LBS' THEN weight / 0.45359237 ELSE weight END),
+    ALTER COLUMN height TYPE integer USING
+        round(CASE WHEN height_unit = 'INCH' THEN height / 2.54 ELSE height END);
+
+COMMIT;
\ No newline at end of file
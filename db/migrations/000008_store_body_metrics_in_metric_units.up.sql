@@ -0,0 +1,14 @@
+BEGIN;
+
+-- weight and height used to be stored in whatever unit the user preferred,
+-- from now on they are always kilograms and centimeters
+ALTER TABLE users
+    ALTER COLUMN weight TYPE numeric(6,2) USING
+        CASE WHEN weight_unit = 'LBS' THEN round(weight * 0.45359237, 2) ELSE weight END,
+    ALTER COLUMN height TYPE numeric(6,2) USING
+        CASE WHEN height_unit = 'INCH' THEN round(height * 2.54, 2) ELSE height END;
+
+COMMENT ON COLUMN users.weight IS 'kilograms';
+COMMENT ON COLUMN users.height IS 'centimeters';
+
+COMMIT;
\ No newline at end of file
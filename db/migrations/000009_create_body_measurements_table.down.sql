@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE body_measurements;
+
+COMMIT;
\ No newline at end of file
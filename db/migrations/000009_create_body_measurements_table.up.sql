@@ -0,0 +1,29 @@
+BEGIN;
+
+CREATE TABLE body_measurements (
+    id                  uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id             uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    measured_at         timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    weight              numeric(6,2),
+    body_fat_percentage numeric(5,2),
+    waist               numeric(6,2),
+    resting_heart_rate  integer,
+    created_at          timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (
+        weight IS NOT NULL
+        OR body_fat_percentage IS NOT NULL
+        OR waist IS NOT NULL
+        OR resting_heart_rate IS NOT NULL
+    )
+);
+
+COMMENT ON COLUMN body_measurements.weight IS 'kilograms';
+COMMENT ON COLUMN body_measurements.waist IS 'centimeters';
+
+CREATE INDEX body_measurements_user_id_measured_at_idx ON body_measurements (user_id, measured_at);
+
+-- keep the weight already on the profiles as the first entry of their history
+INSERT INTO body_measurements (user_id, weight)
+SELECT id, weight FROM users WHERE weight IS NOT NULL;
+
+COMMIT;
\ No newline at end of file
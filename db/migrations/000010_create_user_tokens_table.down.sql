@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE user_tokens;
+
+ALTER TABLE users
+    DROP COLUMN email_verified_at;
+
+COMMIT;
\ No newline at end of file
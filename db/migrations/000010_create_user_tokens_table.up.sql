@@ -0,0 +1,19 @@
+BEGIN;
+
+ALTER TABLE users
+    ADD COLUMN email_verified_at timestamptz;
+
+-- single-use tokens sent by email, only their sha256 hash is stored
+CREATE TABLE user_tokens (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose     text NOT NULL,
+    token_hash  text NOT NULL UNIQUE,
+    expires_at  timestamptz NOT NULL,
+    used_at     timestamptz,
+    created_at  timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX user_tokens_user_id_purpose_idx ON user_tokens (user_id, purpose);
+
+COMMIT;
\ No newline at end of file
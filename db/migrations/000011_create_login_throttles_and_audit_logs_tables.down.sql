@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE audit_logs;
+DROP TABLE login_throttles;
+
+COMMIT;
\ No newline at end of file
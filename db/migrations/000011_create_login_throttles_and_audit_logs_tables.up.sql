@@ -0,0 +1,25 @@
+BEGIN;
+
+-- failed login counters, keyed by account ("email:...") or by client ("ip:...")
+CREATE TABLE login_throttles (
+    key             text PRIMARY KEY,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    last_failed_at  timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until    timestamptz
+);
+
+CREATE TABLE audit_logs (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_id    uuid REFERENCES users(id) ON DELETE SET NULL,
+    action      text NOT NULL,
+    target_type text,
+    target_id   text,
+    ip          text,
+    metadata    jsonb NOT NULL DEFAULT '{}',
+    created_at  timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_logs_created_at_idx ON audit_logs (created_at);
+CREATE INDEX audit_logs_target_idx ON audit_logs (target_type, target_id);
+
+COMMIT;
\ No newline at end of file
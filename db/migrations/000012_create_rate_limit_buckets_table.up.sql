@@ -0,0 +1,11 @@
+BEGIN;
+
+-- token buckets of the rate limiter when it runs with RATE_LIMIT_STORE=postgres
+CREATE UNLOGGED TABLE rate_limit_buckets (
+    key         text PRIMARY KEY,
+    tokens      double precision NOT NULL,
+    allowed     boolean NOT NULL,
+    updated_at  timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP TABLE recovery_codes;
+
+ALTER TABLE users
+    DROP COLUMN totp_secret,
+    DROP COLUMN totp_enabled_at,
+    DROP COLUMN totp_last_counter;
+
+COMMIT;
\ No newline at end of file
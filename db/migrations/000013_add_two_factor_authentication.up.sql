@@ -0,0 +1,19 @@
+BEGIN;
+
+-- totp_secret is encrypted with TOTP_ENCRYPTION_KEY, it is set on enrollment
+-- and only active once totp_enabled_at is set
+ALTER TABLE users
+    ADD COLUMN totp_secret text,
+    ADD COLUMN totp_enabled_at timestamptz,
+    ADD COLUMN totp_last_counter bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+    id          uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id     uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash   text NOT NULL,
+    used_at     timestamptz,
+    created_at  timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE personal_access_tokens;
+
+COMMIT;
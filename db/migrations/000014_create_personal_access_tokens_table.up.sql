@@ -0,0 +1,20 @@
+BEGIN;
+
+-- long lived tokens for scripts and devices, only their sha256 hash is stored
+-- and token_prefix is kept for users to tell them apart
+CREATE TABLE personal_access_tokens (
+    id            uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id       uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          text NOT NULL,
+    scopes        text[] NOT NULL,
+    token_prefix  text NOT NULL,
+    token_hash    text NOT NULL UNIQUE,
+    expires_at    timestamptz,
+    last_used_at  timestamptz,
+    revoked_at    timestamptz,
+    created_at    timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens (user_id);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE users
+    DROP COLUMN role,
+    DROP COLUMN disabled_at;
+
+DROP TYPE user_role;
+
+COMMIT;
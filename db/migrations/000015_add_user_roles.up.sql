@@ -0,0 +1,10 @@
+BEGIN;
+
+CREATE TYPE user_role AS ENUM ('USER', 'COACH', 'ADMIN');
+
+-- disabled users can't log in and their tokens stop working
+ALTER TABLE users
+    ADD COLUMN role user_role NOT NULL DEFAULT 'USER',
+    ADD COLUMN disabled_at timestamptz;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- one row per login, its id is the sid claim of the access token
+CREATE TABLE sessions (
+    id            uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id       uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_name   text,
+    user_agent    text,
+    ip            text,
+    created_at    timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at  timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at    timestamptz NOT NULL,
+    revoked_at    timestamptz
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP TABLE data_exports;
+DROP TYPE data_export_status;
+DROP TABLE uploaded_files;
+
+ALTER TABLE users
+    DROP COLUMN deletion_scheduled_at;
+
+COMMIT;
@@ -0,0 +1,37 @@
+BEGIN;
+
+-- the account and everything it owns is purged once deletion_scheduled_at has
+-- passed, until then the user can cancel
+ALTER TABLE users
+    ADD COLUMN deletion_scheduled_at timestamptz;
+
+-- objects uploaded to the storage backend, to remove them with the account
+CREATE TABLE uploaded_files (
+    id            uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id       uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key           text NOT NULL UNIQUE,
+    content_type  text,
+    size          bigint NOT NULL,
+    created_at    timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX uploaded_files_user_id_idx ON uploaded_files (user_id);
+
+CREATE TYPE data_export_status AS ENUM ('PENDING', 'RUNNING', 'DONE', 'FAILED');
+
+CREATE TABLE data_exports (
+    id            uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id       uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status        data_export_status NOT NULL DEFAULT 'PENDING',
+    file_key      text,
+    error         text,
+    created_at    timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at    timestamptz,
+    completed_at  timestamptz,
+    expires_at    timestamptz
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+CREATE INDEX data_exports_status_idx ON data_exports (status) WHERE status IN ('PENDING', 'RUNNING');
+
+COMMIT;
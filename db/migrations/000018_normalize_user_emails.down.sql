@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE user_tokens
+    DROP COLUMN email;
+
+DROP INDEX users_email_lower_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+COMMIT;
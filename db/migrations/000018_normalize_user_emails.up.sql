@@ -0,0 +1,25 @@
+BEGIN;
+
+-- emails differing only by case must be merged by hand first, see
+-- db/scripts/dedupe_emails.sql
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM users GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1
+    ) THEN
+        RAISE EXCEPTION 'users have emails differing only by case, run db/scripts/dedupe_emails.sql first';
+    END IF;
+END $$;
+
+UPDATE users SET email = LOWER(TRIM(email)) WHERE email <> LOWER(TRIM(email));
+
+-- emails are stored lowercase, the index also covers rows written around the
+-- api
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+CREATE UNIQUE INDEX users_email_lower_key ON users (LOWER(email));
+
+-- the new address an email change token confirms
+ALTER TABLE user_tokens
+    ADD COLUMN email text;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- first response to each Idempotency-Key, replayed when the request is retried
+CREATE TABLE idempotency_keys (
+    user_id           uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key               text NOT NULL,
+    request_hash      text NOT NULL,
+    -- NULL while the first request is running
+    status_code       integer,
+    response_headers  jsonb,
+    response_body     bytea,
+    created_at        timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at        timestamptz NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+COMMIT;
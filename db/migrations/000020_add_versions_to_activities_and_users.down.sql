@@ -0,0 +1,13 @@
+BEGIN;
+
+DROP TRIGGER users_increment_version ON users;
+ALTER TABLE users
+    DROP COLUMN version;
+
+DROP TRIGGER activities_increment_version ON activities;
+ALTER TABLE activities
+    DROP COLUMN version;
+
+DROP FUNCTION increment_version();
+
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN;
+
+-- bumped on every update, the ETag of the row's representation
+CREATE FUNCTION increment_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE activities
+    ADD COLUMN version integer NOT NULL DEFAULT 1;
+
+CREATE TRIGGER activities_increment_version
+    BEFORE UPDATE ON activities
+    FOR EACH ROW EXECUTE FUNCTION increment_version();
+
+-- only the columns of the profile are versioned, logging in or changing the
+-- password doesn't invalidate the ETag
+ALTER TABLE users
+    ADD COLUMN version integer NOT NULL DEFAULT 1;
+
+CREATE TRIGGER users_increment_version
+    BEFORE UPDATE OF
+        preference, weight_unit, height_unit, weight, height, name, image_uri, timezone,
+        email, email_verified_at, role, deletion_scheduled_at
+    ON users
+    FOR EACH ROW EXECUTE FUNCTION increment_version();
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP TABLE activity_revisions;
+
+DROP TRIGGER streak_settings_set_updated_at ON streak_settings;
+DROP TRIGGER goals_set_updated_at ON goals;
+DROP TRIGGER activities_set_updated_at ON activities;
+DROP FUNCTION set_updated_at();
+
+COMMIT;
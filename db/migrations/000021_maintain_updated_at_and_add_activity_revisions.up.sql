@@ -0,0 +1,36 @@
+BEGIN;
+
+-- updated_at is set on every update, whatever the query
+CREATE FUNCTION set_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at := CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER activities_set_updated_at
+    BEFORE UPDATE ON activities
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE TRIGGER goals_set_updated_at
+    BEFORE UPDATE ON goals
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE TRIGGER streak_settings_set_updated_at
+    BEFORE UPDATE ON streak_settings
+    FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- every change made to an activity, before and after hold the changed fields
+CREATE TABLE activity_revisions (
+    id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    activity_id  uuid NOT NULL REFERENCES activities(id) ON DELETE CASCADE,
+    actor_id     uuid REFERENCES users(id) ON DELETE SET NULL,
+    action       text NOT NULL,
+    before       jsonb,
+    after        jsonb,
+    created_at   timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX activity_revisions_activity_id_idx ON activity_revisions (activity_id, created_at);
+
+COMMIT;
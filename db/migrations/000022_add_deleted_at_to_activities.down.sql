@@ -0,0 +1,8 @@
+BEGIN;
+
+DELETE FROM activities WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE activities
+    DROP COLUMN deleted_at;
+
+COMMIT;
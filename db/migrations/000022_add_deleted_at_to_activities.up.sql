@@ -0,0 +1,10 @@
+BEGIN;
+
+-- deleted activities stay in the trash, where they can be restored, until
+-- they are purged after the retention period
+ALTER TABLE activities
+    ADD COLUMN deleted_at timestamptz;
+
+CREATE INDEX activities_deleted_at_idx ON activities (user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP TABLE activity_track_points;
+
+ALTER TABLE activities
+    DROP COLUMN distance_in_meters,
+    DROP COLUMN elevation_gain_in_meters,
+    DROP COLUMN average_heart_rate;
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+-- recorded by devices, unknown for activities entered by hand
+ALTER TABLE activities
+    ADD COLUMN distance_in_meters double precision,
+    ADD COLUMN elevation_gain_in_meters double precision,
+    ADD COLUMN average_heart_rate integer;
+
+CREATE TABLE activity_track_points (
+    activity_id uuid NOT NULL REFERENCES activities (id) ON DELETE CASCADE,
+    recorded_at timestamptz NOT NULL,
+    latitude    double precision,
+    longitude   double precision,
+    elevation   double precision,
+    heart_rate  integer
+);
+
+CREATE INDEX activity_track_points_activity_id_idx ON activity_track_points (activity_id, recorded_at);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE activity_track_points
+    ADD COLUMN power integer;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE history_import_errors;
+DROP TABLE history_imports;
+DROP TYPE history_import_status;
+
+COMMIT;
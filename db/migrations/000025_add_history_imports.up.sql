@@ -0,0 +1,39 @@
+BEGIN;
+
+CREATE TYPE history_import_status AS ENUM ('PENDING', 'RUNNING', 'DONE', 'FAILED');
+
+-- the history exported from another platform, imported in the background.
+-- processed_records is a checkpoint, an import taken over after its instance
+-- died resumes after it
+CREATE TABLE history_imports (
+    id                    uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id               uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source                text NOT NULL,
+    file_key              text NOT NULL,
+    status                history_import_status NOT NULL DEFAULT 'PENDING',
+    total_bytes           bigint NOT NULL,
+    processed_bytes       bigint NOT NULL DEFAULT 0,
+    processed_records     integer NOT NULL DEFAULT 0,
+    imported_activities   integer NOT NULL DEFAULT 0,
+    imported_measurements integer NOT NULL DEFAULT 0,
+    skipped_records       integer NOT NULL DEFAULT 0,
+    failed_records        integer NOT NULL DEFAULT 0,
+    error                 text,
+    created_at            timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at            timestamptz,
+    heartbeat_at          timestamptz,
+    completed_at          timestamptz
+);
+
+CREATE INDEX history_imports_user_id_idx ON history_imports (user_id);
+CREATE INDEX history_imports_status_idx ON history_imports (status) WHERE status IN ('PENDING', 'RUNNING');
+
+CREATE TABLE history_import_errors (
+    id           bigserial PRIMARY KEY,
+    import_id    uuid NOT NULL REFERENCES history_imports(id) ON DELETE CASCADE,
+    record_index integer NOT NULL,
+    message      text NOT NULL,
+    UNIQUE (import_id, record_index)
+);
+
+COMMIT;
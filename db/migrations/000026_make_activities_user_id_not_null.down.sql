@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE activities ALTER COLUMN user_id DROP NOT NULL;
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- the activities left without a user by migration 000004 must be given one
+-- first, see db/scripts/assign_activities.sql
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM activities WHERE user_id IS NULL) THEN
+        RAISE EXCEPTION 'activities have no user, run db/scripts/assign_activities.sql first';
+    END IF;
+END $$;
+
+ALTER TABLE activities ALTER COLUMN user_id SET NOT NULL;
+
+COMMIT;
@@ -0,0 +1,34 @@
+-- Gives the activities recorded before they were tied to a user, which
+-- migration 000026 refuses to run with, to the account of the given email.
+-- Nothing tells whose they were, so they all go to that one account; it is
+-- recorded in the audit log.
+--
+-- make activities.assign email=a@a.a
+
+BEGIN;
+
+CREATE TEMPORARY TABLE assigned_activities ON COMMIT DROP AS
+SELECT a.id, u.id AS user_id
+FROM activities a
+CROSS JOIN users u
+WHERE a.user_id IS NULL AND u.email = LOWER(TRIM(:'email'));
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM assigned_activities) AND EXISTS (SELECT 1 FROM activities WHERE user_id IS NULL) THEN
+        RAISE EXCEPTION 'no user has this email';
+    END IF;
+END $$;
+
+UPDATE activities
+SET user_id = assigned_activities.user_id
+FROM assigned_activities
+WHERE activities.id = assigned_activities.id;
+
+INSERT INTO audit_logs (action, target_type, target_id, metadata)
+SELECT 'activity.owner_assigned', 'activity', id::text, jsonb_build_object('userId', user_id)
+FROM assigned_activities;
+
+SELECT COUNT(*) AS assigned FROM assigned_activities;
+
+COMMIT;
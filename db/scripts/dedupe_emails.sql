@@ -0,0 +1,45 @@
+-- Resolves the accounts whose emails differ only by case, which migration
+-- 000018 refuses to run with. Of each group the account with a verified email
+-- is kept, then the one last seen, then the oldest id. The others are
+-- disabled, logged out, and their email is replaced by an undeliverable one;
+-- the original is kept in the audit log so support can merge them by hand.
+--
+-- make email.dedupe
+
+BEGIN;
+
+CREATE TEMPORARY TABLE duplicate_users ON COMMIT DROP AS
+SELECT id, email
+FROM (
+    SELECT
+        u.id,
+        u.email,
+        ROW_NUMBER() OVER (
+            PARTITION BY LOWER(TRIM(u.email))
+            ORDER BY
+                u.email_verified_at IS NULL,
+                (SELECT MAX(s.last_seen_at) FROM sessions s WHERE s.user_id = u.id) DESC NULLS LAST,
+                u.id
+        ) AS rank
+    FROM users u
+) ranked
+WHERE rank > 1;
+
+INSERT INTO audit_logs (action, target_type, target_id, metadata)
+SELECT 'user.email_deduplicated', 'user', id::text, jsonb_build_object('email', email)
+FROM duplicate_users;
+
+UPDATE users
+SET email = 'duplicate-' || users.id || '@invalid',
+    disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP)
+FROM duplicate_users
+WHERE users.id = duplicate_users.id;
+
+UPDATE sessions
+SET revoked_at = CURRENT_TIMESTAMP
+FROM duplicate_users
+WHERE sessions.user_id = duplicate_users.id AND sessions.revoked_at IS NULL;
+
+SELECT id, email AS original_email FROM duplicate_users;
+
+COMMIT;
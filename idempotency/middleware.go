@@ -0,0 +1,194 @@
+// Package idempotency lets clients retry write requests safely: a request
+// sent with an Idempotency-Key header runs once per user and key, retries get
+// the first response back.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+const maxKeyLength = 255
+
+// maxBodySize is the largest body kept to tell requests apart, write requests
+// carry small JSON documents.
+const maxBodySize = 1 << 20 // 1MB
+
+// Middleware must run after the jwt authenticator, keys being scoped to the
+// user.
+type Middleware struct {
+	store *Store
+	// ttl is how long a key is remembered
+	ttl time.Duration
+	// lockTimeout is how long a request may run before a retry is allowed to
+	// take over its key
+	lockTimeout time.Duration
+}
+
+func NewMiddleware(store *Store, ttl time.Duration, lockTimeout time.Duration) *Middleware {
+	return &Middleware{store, ttl, lockTimeout}
+}
+
+// Handler runs POST, PUT, PATCH and DELETE requests having an Idempotency-Key
+// header only once. Retries with the same key get the stored status, headers
+// and body along with an Idempotent-Replayed header. A retry arriving while
+// the first request still runs, or reusing the key for another request, is
+// rejected with 409 and 422. Server errors aren't stored, so the request can
+// be retried.
+//
+// File uploads, multipart requests, go through as if they had no key: their
+// bodies can weigh gigabytes and aren't held in memory. Other bodies are
+// limited to maxBodySize.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if isMultipart(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		_, claims, _ := jwtauth.FromContext(r.Context())
+		userId, ok := claims["userId"].(string)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, "Request body is too large for an idempotent request", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := hashRequest(r, body)
+
+		record, err := m.store.Start(r.Context(), userId, key, requestHash, m.ttl, m.lockTimeout)
+		if err != nil {
+			log.Println("Error starting idempotent request:", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if record != nil {
+			replay(w, record, requestHash)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, headersBefore: w.Header().Clone()}
+		next.ServeHTTP(recorder, r)
+
+		// the request is over even if the client left, so its context isn't used
+		ctx := context.WithoutCancel(r.Context())
+		if recorder.statusCode >= http.StatusInternalServerError {
+			if err := m.store.Release(ctx, userId, key); err != nil {
+				log.Println("Error releasing idempotency key:", err)
+			}
+			return
+		}
+		if err := m.store.Complete(ctx, userId, key, recorder.record()); err != nil {
+			log.Println("Error storing idempotent response:", err)
+		}
+	})
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
+
+// hashRequest tells apart requests reusing a key for something else.
+func hashRequest(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, record *Record, requestHash string) {
+	if record.RequestHash != requestHash {
+		http.Error(w, "Idempotency-Key was already used for another request", http.StatusUnprocessableEntity)
+		return
+	}
+	if record.StatusCode == 0 {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	}
+
+	for name, values := range record.Headers {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// responseRecorder passes the response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	// headersBefore were set by the middlewares running before, like the rate
+	// limiter, and aren't part of the stored response
+	headersBefore http.Header
+	statusCode    int
+	headers       http.Header
+	body          bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.statusCode == 0 {
+		r.statusCode = statusCode
+		r.headers = http.Header{}
+		for name, values := range r.Header() {
+			if _, ok := r.headersBefore[name]; !ok {
+				r.headers[name] = values
+			}
+		}
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) record() Record {
+	if r.statusCode == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+
+	return Record{
+		StatusCode: r.statusCode,
+		Headers:    r.headers,
+		Body:       r.body.Bytes(),
+	}
+}
@@ -0,0 +1,125 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Record is what is kept of a request made with an Idempotency-Key.
+type Record struct {
+	RequestHash string
+	// StatusCode is zero while the first request is running
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+}
+
+// Store keeps the records in postgres, so retries reaching another instance
+// of the server are recognized too.
+type Store struct {
+	pgConn *pgxpool.Pool
+}
+
+func NewStore(pgConn *pgxpool.Pool) *Store {
+	return &Store{pgConn}
+}
+
+// Start records that the request identified by userId and key is running and
+// returns nil, or returns the existing record when the key is already known.
+// Keys past their ttl, and keys whose request has been running for longer
+// than lockTimeout because its instance died, are started over.
+func (s *Store) Start(ctx context.Context, userId string, key string, requestHash string, ttl time.Duration, lockTimeout time.Duration) (*Record, error) {
+	query := `
+	INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at)
+	VALUES (@user_id, @key, @request_hash, CURRENT_TIMESTAMP + @ttl::interval)
+	ON CONFLICT (user_id, key) DO UPDATE SET
+		request_hash = EXCLUDED.request_hash,
+		status_code = NULL,
+		response_headers = NULL,
+		response_body = NULL,
+		created_at = CURRENT_TIMESTAMP,
+		expires_at = EXCLUDED.expires_at
+	WHERE idempotency_keys.expires_at <= CURRENT_TIMESTAMP
+		OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < CURRENT_TIMESTAMP - @lock_timeout::interval)
+	`
+	args := pgx.NamedArgs{
+		"user_id":      userId,
+		"key":          key,
+		"request_hash": requestHash,
+		"ttl":          ttl,
+		"lock_timeout": lockTimeout,
+	}
+
+	commandTag, err := s.pgConn.Exec(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if commandTag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	record := Record{}
+	var statusCode *int
+	err = s.pgConn.QueryRow(ctx, `
+	SELECT request_hash, status_code, response_headers, response_body
+	FROM idempotency_keys
+	WHERE user_id = @user_id AND key = @key
+	`, args).Scan(&record.RequestHash, &statusCode, &record.Headers, &record.Body)
+	if err != nil {
+		// the key expired and was purged in between, the client can retry
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &Record{RequestHash: requestHash}, nil
+		}
+
+		return nil, err
+	}
+	if statusCode != nil {
+		record.StatusCode = *statusCode
+	}
+
+	return &record, nil
+}
+
+// Complete stores the response of the request, to be replayed.
+func (s *Store) Complete(ctx context.Context, userId string, key string, record Record) error {
+	query := `
+	UPDATE idempotency_keys
+	SET status_code = @status_code, response_headers = @response_headers, response_body = @response_body
+	WHERE user_id = @user_id AND key = @key
+	`
+	args := pgx.NamedArgs{
+		"user_id":          userId,
+		"key":              key,
+		"status_code":      record.StatusCode,
+		"response_headers": record.Headers,
+		"response_body":    record.Body,
+	}
+
+	_, err := s.pgConn.Exec(ctx, query, args)
+
+	return err
+}
+
+// Release forgets the key, so the request can be retried.
+func (s *Store) Release(ctx context.Context, userId string, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE user_id = @user_id AND key = @key`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+		"key":     key,
+	}
+
+	_, err := s.pgConn.Exec(ctx, query, args)
+
+	return err
+}
+
+func (s *Store) DeleteExpired(ctx context.Context) error {
+	_, err := s.pgConn.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= CURRENT_TIMESTAMP`)
+
+	return err
+}
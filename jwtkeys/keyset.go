@@ -0,0 +1,204 @@
+// Package jwtkeys signs and verifies the api tokens with asymmetric keys, so
+// verifying a token doesn't allow minting one.
+//
+// Keys are PEM files in a directory, the file name without its extension
+// being the key id set in the "kid" header of the tokens it signs. Private
+// keys (RSA for RS256, Ed25519 for EdDSA) can sign, public keys only verify.
+// The public part of every key is published on /.well-known/jwks.json.
+//
+// To rotate keys:
+//  1. add the new private key to the directory of every instance and restart
+//     them, so they all accept tokens signed with it;
+//  2. point JWT_SIGNING_KEY_ID at the new key and restart again;
+//  3. replace the old private key with its public key, and remove that one
+//     once the last token it signed has expired.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+type KeySet struct {
+	signingKey jwk.Key
+	publicKeys jwk.Set
+}
+
+// Load reads every .pem file in dir. Tokens are signed with the private key
+// named signingKeyId, which can be left empty when dir holds a single private
+// key.
+func Load(dir string, signingKeyId string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	keySet := &KeySet{publicKeys: jwk.NewSet()}
+	var privateKeys []jwk.Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwk.ParseKey(data, jwk.WithPEM(true))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+		}
+
+		keyId := strings.TrimSuffix(filepath.Base(path), ".pem")
+		if err := keySet.add(keyId, key); err != nil {
+			return nil, fmt.Errorf("failed to load key %s: %w", path, err)
+		}
+		if isPrivate(key) {
+			privateKeys = append(privateKeys, key)
+		}
+	}
+
+	for _, key := range privateKeys {
+		if key.KeyID() == signingKeyId || (signingKeyId == "" && len(privateKeys) == 1) {
+			keySet.signingKey = key
+		}
+	}
+	if keySet.signingKey == nil {
+		if signingKeyId == "" {
+			return nil, fmt.Errorf("%s must hold exactly one private key, or the signing key id must be set", dir)
+		}
+		return nil, fmt.Errorf("no private key %q in %s", signingKeyId, dir)
+	}
+
+	return keySet, nil
+}
+
+// Generate makes a key set out of a new Ed25519 key. Its tokens stop being
+// valid once the process exits, which is only fine for development.
+func Generate() (*KeySet, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := jwk.FromRaw(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := &KeySet{signingKey: key, publicKeys: jwk.NewSet()}
+	if err := keySet.add(fmt.Sprintf("%x", thumbprint[:8]), key); err != nil {
+		return nil, err
+	}
+
+	return keySet, nil
+}
+
+func (k *KeySet) add(keyId string, key jwk.Key) error {
+	var alg jwa.SignatureAlgorithm
+	switch key.KeyType() {
+	case jwa.RSA:
+		alg = jwa.RS256
+	case jwa.OKP:
+		if crv, ok := key.Get("crv"); !ok || crv != jwa.Ed25519 {
+			return fmt.Errorf("only Ed25519 is supported among OKP keys")
+		}
+		alg = jwa.EdDSA
+	default:
+		return fmt.Errorf("unsupported key type %s, expected RSA or Ed25519", key.KeyType())
+	}
+
+	for name, value := range map[string]any{
+		jwk.KeyIDKey:     keyId,
+		jwk.AlgorithmKey: alg,
+		jwk.KeyUsageKey:  jwk.ForSignature,
+	} {
+		if err := key.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return err
+	}
+
+	return k.publicKeys.AddKey(publicKey)
+}
+
+func isPrivate(key jwk.Key) bool {
+	switch key.(type) {
+	case jwk.RSAPrivateKey, jwk.OKPPrivateKey:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sign encodes claims into a token signed with the current signing key.
+func (k *KeySet) Sign(claims map[string]any) (string, error) {
+	token := jwt.New()
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			return "", err
+		}
+	}
+
+	signed, err := jwt.Sign(token, jwt.WithKey(k.signingKey.Algorithm(), k.signingKey))
+	if err != nil {
+		return "", err
+	}
+
+	return string(signed), nil
+}
+
+// Verify checks the token was signed by one of the keys, going by its "kid"
+// header, and that it hasn't expired. Errors are the ones of jwtauth.
+func (k *KeySet) Verify(tokenString string) (jwt.Token, error) {
+	token, err := jwt.ParseString(tokenString, jwt.WithKeySet(k.publicKeys), jwt.WithValidate(true))
+	if err != nil {
+		return nil, jwtauth.ErrorReason(err)
+	}
+
+	return token, nil
+}
+
+// Verifier is the counterpart of jwtauth.Verifier: it puts the token of the
+// request, or the reason it isn't valid, in the context for
+// jwtauth.Authenticator and jwtauth.FromContext.
+func (k *KeySet) Verifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := jwtauth.TokenFromHeader(r)
+		if tokenString == "" {
+			tokenString = jwtauth.TokenFromCookie(r)
+		}
+
+		var token jwt.Token
+		err := jwtauth.ErrNoTokenFound
+		if tokenString != "" {
+			token, err = k.Verify(tokenString)
+		}
+
+		next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, err)))
+	})
+}
+
+// HandleJWKS publishes the public keys, for other services to verify tokens.
+func (k *KeySet) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(k.publicKeys)
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails. Drivers are picked with the MAIL_DRIVER env
+// variable, see NewSenderFromEnv.
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// NewSenderFromEnv returns the SMTP driver when MAIL_DRIVER is "smtp", the
+// in-memory one for "memory" and otherwise writes emails to MAIL_DIR, which is
+// handy for local development.
+func NewSenderFromEnv() Sender {
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		return NewSMTPSender(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("MAIL_FROM"),
+		)
+	case "memory":
+		return NewMemorySender()
+	default:
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "tmp/mail"
+		}
+		log.Println("Emails are written to", dir)
+		return NewFileSender(dir, os.Getenv("MAIL_FROM"))
+	}
+}
+
+func formatMessage(from string, message Message) []byte {
+	return []byte(fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=\"utf-8\"\r\n\r\n%s\r\n",
+		from, message.To, message.Subject, message.Body,
+	))
+}
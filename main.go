@@ -2,22 +2,43 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"fit-byte/authz"
+	"fit-byte/background"
 	"fit-byte/constants"
 	"fit-byte/db"
+	"fit-byte/idempotency"
+	"fit-byte/jwtkeys"
+	"fit-byte/mailer"
+	"fit-byte/password"
+	"fit-byte/ratelimit"
+	"fit-byte/usecases/accesstoken"
+	"fit-byte/usecases/account"
 	"fit-byte/usecases/activity"
+	"fit-byte/usecases/admin"
+	"fit-byte/usecases/audit"
 	"fit-byte/usecases/auth"
 	"fit-byte/usecases/file"
+	"fit-byte/usecases/goal"
+	"fit-byte/usecases/importer"
+	"fit-byte/usecases/measurement"
+	"fit-byte/usecases/session"
+	"fit-byte/usecases/streak"
+	"fit-byte/usecases/twofactor"
 	"fit-byte/usecases/user"
 	"fit-byte/utils"
 	"log"
 	"net/http"
 	"os"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/jwtauth/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
@@ -33,6 +54,99 @@ func initS3(ctx context.Context) error {
 	return nil
 }
 
+// initRateLimiter keeps the buckets in memory unless RATE_LIMIT_STORE is
+// "postgres", which is needed when several instances run behind a load balancer.
+func initRateLimiter(pgConn *pgxpool.Pool) *ratelimit.Limiter {
+	policies, err := ratelimit.ParsePolicies(os.Getenv("RATE_LIMIT_POLICIES"))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		store = ratelimit.NewPostgresStore(pgConn)
+	}
+
+	return ratelimit.NewLimiter(store, policies)
+}
+
+// initTwoFactorKey reads the base64 encoded 32 bytes key TOTP secrets are
+// encrypted with. Two-factor enrollment is disabled when it isn't set.
+func initTwoFactorKey() []byte {
+	encodedKey := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if encodedKey == "" {
+		return nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		log.Fatal("TOTP_ENCRYPTION_KEY must be 32 bytes encoded in base64")
+	}
+
+	return key
+}
+
+// initPasswords reads the password hashing params and policy, see the
+// password package for the variables.
+func initPasswords() (*password.Hasher, password.Policy) {
+	hasher, err := password.NewHasherFromEnv()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	policy, err := password.NewPolicyFromEnv(hasher)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return hasher, policy
+}
+
+// initTrashRetention reads how long deleted activities stay in the trash,
+// ACTIVITY_TRASH_RETENTION is a duration such as "720h".
+func initTrashRetention() time.Duration {
+	value := os.Getenv("ACTIVITY_TRASH_RETENTION")
+	if value == "" {
+		return constants.ACTIVITY_TRASH_RETENTION
+	}
+
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention <= 0 {
+		log.Fatal("ACTIVITY_TRASH_RETENTION must be a positive duration")
+	}
+
+	return retention
+}
+
+// initTrustedProxies reads TRUSTED_PROXIES, the ips and CIDRs of the load
+// balancers in front of the api, comma separated. Client ips are read from
+// X-Forwarded-For only when the request comes from one of them.
+func initTrustedProxies() {
+	if err := utils.SetTrustedProxies(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+// initKeySet loads the token signing keys from JWT_KEYS_DIR. Without it a
+// throwaway key is generated, and tokens don't survive a restart.
+func initKeySet() *jwtkeys.KeySet {
+	keysDir := os.Getenv("JWT_KEYS_DIR")
+	if keysDir == "" {
+		log.Println("JWT_KEYS_DIR is not set, signing tokens with a throwaway key")
+		keySet, err := jwtkeys.Generate()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		return keySet
+	}
+
+	keySet, err := jwtkeys.Load(keysDir, os.Getenv("JWT_SIGNING_KEY_ID"))
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	return keySet
+}
+
 func main() {
     err := godotenv.Load(".env")
 	if err != nil {
@@ -44,47 +158,184 @@ func main() {
 	if err := initS3(ctx); err != nil {
 		log.Fatal(err.Error())
 	}
+	initTrustedProxies()
 
     userRepository := user.NewUserRepository(ctx, pgConn)
+	tokenRepository := auth.NewTokenRepository(ctx, pgConn)
+	loginThrottleRepository := auth.NewLoginThrottleRepository(ctx, pgConn)
+	auditRepository := audit.NewAuditRepository(ctx, pgConn)
 	activityRepository := activity.NewActivityRepository(ctx, pgConn)
+	importerRepository := importer.NewImporterRepository(ctx, pgConn)
+	goalRepository := goal.NewGoalRepository(ctx, pgConn)
+	streakRepository := streak.NewStreakRepository(ctx, pgConn)
+	measurementRepository := measurement.NewMeasurementRepository(ctx, pgConn)
+	twoFactorRepository := twofactor.NewTwoFactorRepository(ctx, pgConn)
+	accessTokenRepository := accesstoken.NewAccessTokenRepository(ctx, pgConn)
+	sessionRepository := session.NewSessionRepository(ctx, pgConn)
+	fileRepository := file.NewFileRepository(ctx, pgConn)
+	accountRepository := account.NewAccountRepository(ctx, pgConn)
+
+	mailSender := mailer.NewSenderFromEnv()
+	limiter := initRateLimiter(pgConn)
+	keySet := initKeySet()
+	passwordHasher, passwordPolicy := initPasswords()
+	idempotencyStore := idempotency.NewStore(pgConn)
+	idempotencyMiddleware := idempotency.NewMiddleware(idempotencyStore, constants.IDEMPOTENCY_KEY_TTL, constants.IDEMPOTENCY_LOCK_TIMEOUT)
 
-    authService := auth.NewAuthService(userRepository)
-    userService := user.NewUserService(userRepository)
-	activityService := activity.NewActivityService(activityRepository)
-	fileService := file.NewFileService(s3Client, ctx)
+	sessionService := session.NewSessionService(sessionRepository)
+	twoFactorService := twofactor.NewTwoFactorService(twoFactorRepository, userRepository, initTwoFactorKey(), passwordHasher)
+    authService := auth.NewAuthService(userRepository, tokenRepository, loginThrottleRepository, auditRepository, mailSender, twoFactorService, keySet, sessionService, passwordHasher, passwordPolicy)
+	measurementService := measurement.NewMeasurementService(measurementRepository, userRepository)
+    userService := user.NewUserService(userRepository, &measurementService)
+	activityService := activity.NewActivityService(activityRepository, initTrashRetention())
+	fileService := file.NewFileService(s3Client, ctx, fileRepository)
+	goalService := goal.NewGoalService(goalRepository)
+	streakService := streak.NewStreakService(streakRepository, userRepository)
+	importerService := importer.NewImporterService(importerRepository, activityService, measurementService, fileService)
+	accessTokenService := accesstoken.NewAccessTokenService(accessTokenRepository)
+	adminService := admin.NewAdminService(userRepository, activityRepository, auditRepository, authService, sessionService, passwordHasher)
+	accountService := account.NewAccountService(accountRepository, userRepository, auditRepository, fileService, sessionService, passwordHasher)
+	authorizer := authz.NewAuthorizer(userRepository)
     
     authHandler := auth.NewAuthHandler(authService)
     userHandler := user.NewUserHandler(userService)
 	activityHandler := activity.NewActivityHandler(activityService)
+	importerHandler := importer.NewImporterHandler(importerService)
 	fileHandler := file.NewFileHandler(fileService)
+	goalHandler := goal.NewGoalHandler(goalService)
+	streakHandler := streak.NewStreakHandler(streakService)
+	measurementHandler := measurement.NewMeasurementHandler(measurementService)
+	twoFactorHandler := twofactor.NewTwoFactorHandler(twoFactorService)
+	accessTokenHandler := accesstoken.NewAccessTokenHandler(accessTokenService)
+	adminHandler := admin.NewAdminHandler(adminService)
+	sessionHandler := session.NewSessionHandler(sessionService)
+	accountHandler := account.NewAccountHandler(accountService)
+
+	go background.Every(ctx, "data exports", 10*time.Second, accountService.ProcessExports)
+	go background.Every(ctx, "expired exports purge", time.Hour, accountService.PurgeExpiredExports)
+	go background.Every(ctx, "deleted accounts purge", time.Hour, accountService.PurgeDeletedAccounts)
+	go background.Every(ctx, "history imports", 10*time.Second, importerService.ProcessHistoryImports)
+	go background.Every(ctx, "activity trash purge", time.Hour, activityService.PurgeTrash)
+	go background.Every(ctx, "rate limit buckets purge", 10*time.Minute, func() error {
+		return limiter.DeleteFullBuckets(ctx)
+	})
+	go background.Every(ctx, "idempotency keys purge", time.Hour, func() error {
+		return idempotencyStore.DeleteExpired(ctx)
+	})
     
     r := chi.NewRouter()
     r.Use(middleware.Logger)
 	r.Use(middleware.Heartbeat("/ping"))
+
+	r.With(limiter.Limit("default", ratelimit.ByIP)).Get("/.well-known/jwks.json", keySet.HandleJWKS)
     
     r.Route("/v1", func(r chi.Router) {
 		// public
 		r.Group(func(r chi.Router) {
-			r.Post("/register", utils.AppHandler(authHandler.HandleRegister))
-			r.Post("/login", utils.AppHandler(authHandler.HandleLogin))
+			r.Use(limiter.Limit("default", ratelimit.ByIP))
+
+			r.With(limiter.Limit("register", ratelimit.ByIP)).Post("/register", utils.AppHandler(authHandler.HandleRegister))
+			r.With(limiter.Limit("login", ratelimit.ByIP)).Post("/login", utils.AppHandler(authHandler.HandleLogin))
+			r.With(limiter.Limit("login", ratelimit.ByIP)).Post("/login/2fa", utils.AppHandler(authHandler.HandleLoginTwoFactor))
+			r.With(limiter.Limit("email", ratelimit.ByIP)).Post("/password/forgot", utils.AppHandler(authHandler.HandleForgotPassword))
+			r.With(limiter.Limit("login", ratelimit.ByIP)).Post("/password/reset", utils.AppHandler(authHandler.HandleResetPassword))
+			r.Post("/email/verify", utils.AppHandler(authHandler.HandleVerifyEmail))
+			r.Post("/email/change/confirm", utils.AppHandler(authHandler.HandleConfirmEmailChange))
 		})
 
-		// protected
+		// protected, with a login token or a personal access token having the
+		// route's scope
 		r.Group(func(r chi.Router) {
-			tokenAuth := jwtauth.New(constants.HASH_ALG, []byte(constants.JWT_SECRET), nil)
-			r.Use(jwtauth.Verifier(tokenAuth))
-			r.Use(jwtauth.Authenticator(tokenAuth))
+			r.Use(keySet.Verifier)
+			r.Use(sessionHandler.Verifier)
+			r.Use(accessTokenHandler.Verifier)
+			// the authenticator only reads what the verifiers put in the context
+			r.Use(jwtauth.Authenticator(nil))
+			r.Use(utils.RequireAccessToken)
+			r.Use(authorizer.LoadRole)
 			r.Use(utils.AllowContentType("application/json", "multipart/form-data"))
+			r.Use(limiter.Limit("default", ratelimit.ByAPIKey))
+			r.Use(idempotencyMiddleware.Handler)
+
+			activityRead := utils.RequireScope(constants.SCOPE_ACTIVITY_READ)
+			activityWrite := utils.RequireScope(constants.SCOPE_ACTIVITY_WRITE)
+			profileRead := utils.RequireScope(constants.SCOPE_PROFILE_READ)
+			profileWrite := utils.RequireScope(constants.SCOPE_PROFILE_WRITE)
+
+			r.With(profileRead).Get("/user", utils.AppHandler(userHandler.HandleGetUser))
+			r.With(profileWrite).Patch("/user", utils.AppHandler(userHandler.HandleUpdateUser))
+
+			r.With(activityRead).Get("/activity", utils.AppHandler(activityHandler.HandleGetAllActivities))
+			r.With(activityWrite).Post("/activity", utils.AppHandler(activityHandler.HandleCreateActivity))
+			r.With(activityWrite).Post("/activity/batch", utils.AppHandler(activityHandler.HandleCreateActivities))
+			r.With(activityWrite).Patch("/activity/batch", utils.AppHandler(activityHandler.HandleUpdateActivities))
+			r.With(activityWrite).Post("/activity/batch/delete", utils.AppHandler(activityHandler.HandleDeleteActivities))
+			r.With(activityRead).Get("/activity/export", utils.AppHandler(activityHandler.HandleExportActivities))
+			r.With(activityWrite, limiter.Limit("file", ratelimit.ByUserId)).Post("/activity/import", utils.AppHandler(importerHandler.HandleImportActivitiesCSV))
+			r.With(activityWrite, limiter.Limit("file", ratelimit.ByUserId)).Post("/activity/import/workout", utils.AppHandler(importerHandler.HandleImportWorkout))
+			r.With(activityWrite, limiter.Limit("file", ratelimit.ByUserId)).Post("/activity/import/history", utils.AppHandler(importerHandler.HandleRequestHistoryImport))
+			r.With(activityRead).Get("/activity/import/history", utils.AppHandler(importerHandler.HandleGetHistoryImports))
+			r.With(activityRead).Get("/activity/import/history/{importId}", utils.AppHandler(importerHandler.HandleGetHistoryImport))
+			r.With(activityRead).Get("/activity/trash", utils.AppHandler(activityHandler.HandleGetTrash))
+			r.With(activityRead).Get("/activity/{activityId}", utils.AppHandler(activityHandler.HandleGetActivity))
+			r.With(activityRead).Get("/activity/{activityId}/history", utils.AppHandler(activityHandler.HandleGetActivityHistory))
+			r.With(activityRead).Get("/activity/{activityId}/track", utils.AppHandler(activityHandler.HandleGetActivityTrack))
+			r.With(activityWrite).Post("/activity/{activityId}/restore", utils.AppHandler(activityHandler.HandleRestoreActivity))
+			r.With(activityWrite).Patch("/activity/{activityId}", utils.AppHandler(activityHandler.HandleUpdateActivity))
+			r.With(activityWrite).Delete("/activity/{activityId}", utils.AppHandler(activityHandler.HandleDeleteActivity))
+
+			r.With(profileWrite, limiter.Limit("file", ratelimit.ByUserId)).Post("/file", utils.AppHandler(fileHandler.HandleUploadFile))
+
+			r.With(activityRead).Get("/goals", utils.AppHandler(goalHandler.HandleGetGoals))
+			r.With(activityWrite).Post("/goals", utils.AppHandler(goalHandler.HandleCreateGoal))
+			r.With(activityRead).Get("/goals/{goalId}/history", utils.AppHandler(goalHandler.HandleGetGoalHistory))
+			r.With(activityWrite).Delete("/goals/{goalId}", utils.AppHandler(goalHandler.HandleDeleteGoal))
+
+			r.With(activityRead).Get("/streaks", utils.AppHandler(streakHandler.HandleGetStreaks))
+			r.With(activityWrite).Put("/streaks/settings", utils.AppHandler(streakHandler.HandleUpdateStreakSettings))
+
+			r.With(profileRead).Get("/measurements", utils.AppHandler(measurementHandler.HandleGetMeasurements))
+			r.With(profileWrite).Post("/measurements", utils.AppHandler(measurementHandler.HandleCreateMeasurement))
+			r.With(profileWrite).Delete("/measurements/{measurementId}", utils.AppHandler(measurementHandler.HandleDeleteMeasurement))
+
+			// account management, only with a login token
+			r.Group(func(r chi.Router) {
+				r.Use(utils.RejectPersonalAccessTokens)
+
+				r.Post("/password/change", utils.AppHandler(authHandler.HandleChangePassword))
+				r.With(limiter.Limit("email", ratelimit.ByUserId)).Post("/email/verify/resend", utils.AppHandler(authHandler.HandleResendEmailVerification))
+				r.With(limiter.Limit("email", ratelimit.ByUserId)).Post("/email/change", utils.AppHandler(authHandler.HandleChangeEmail))
+
+				r.Post("/2fa/enroll", utils.AppHandler(twoFactorHandler.HandleEnroll))
+				r.With(limiter.Limit("login", ratelimit.ByUserId)).Post("/2fa/confirm", utils.AppHandler(twoFactorHandler.HandleConfirm))
+				r.With(limiter.Limit("login", ratelimit.ByUserId)).Post("/2fa/disable", utils.AppHandler(twoFactorHandler.HandleDisable))
+				r.With(limiter.Limit("login", ratelimit.ByUserId)).Post("/2fa/recovery-codes", utils.AppHandler(twoFactorHandler.HandleRegenerateRecoveryCodes))
+
+				r.Delete("/user", utils.AppHandler(accountHandler.HandleDeleteAccount))
+				r.Post("/user/deletion/cancel", utils.AppHandler(accountHandler.HandleCancelDeletion))
+				r.With(limiter.Limit("email", ratelimit.ByUserId)).Post("/user/exports", utils.AppHandler(accountHandler.HandleRequestExport))
+				r.Get("/user/exports", utils.AppHandler(accountHandler.HandleGetExports))
+				r.Get("/user/exports/{exportId}", utils.AppHandler(accountHandler.HandleGetExport))
+
+				r.Get("/sessions", utils.AppHandler(sessionHandler.HandleGetSessions))
+				r.Delete("/sessions", utils.AppHandler(sessionHandler.HandleRevokeOtherSessions))
+				r.Delete("/sessions/{sessionId}", utils.AppHandler(sessionHandler.HandleRevokeSession))
 
-			r.Get("/user", utils.AppHandler(userHandler.HandleGetUser))
-			r.Patch("/user", utils.AppHandler(userHandler.HandleUpdateUser))
+				r.Get("/tokens", utils.AppHandler(accessTokenHandler.HandleGetTokens))
+				r.Post("/tokens", utils.AppHandler(accessTokenHandler.HandleCreateToken))
+				r.Delete("/tokens/{tokenId}", utils.AppHandler(accessTokenHandler.HandleRevokeToken))
 
-			r.Get("/activity", utils.AppHandler(activityHandler.HandleGetAllActivities))
-			r.Post("/activity", utils.AppHandler(activityHandler.HandleCreateActivity))
-			r.Patch("/activity/{activityId}", utils.AppHandler(activityHandler.HandleUpdateActivity))
-			r.Delete("/activity/{activityId}", utils.AppHandler(activityHandler.HandleDeleteActivity))
+				readUsers := authz.RequirePermission(authz.ReadUsers)
+				manageUsers := authz.RequirePermission(authz.ManageUsers)
+				readAnyActivities := authz.RequirePermission(authz.ReadAnyActivities)
 
-			r.Post("/file", utils.AppHandler(fileHandler.HandleUploadFile))
+				r.With(readUsers).Get("/admin/users", utils.AppHandler(adminHandler.HandleSearchUsers))
+				r.With(manageUsers).Post("/admin/users/{userId}/disable", utils.AppHandler(adminHandler.HandleDisableUser))
+				r.With(manageUsers).Post("/admin/users/{userId}/enable", utils.AppHandler(adminHandler.HandleEnableUser))
+				r.With(manageUsers).Put("/admin/users/{userId}/role", utils.AppHandler(adminHandler.HandleUpdateUserRole))
+				r.With(manageUsers).Post("/admin/users/{userId}/password-reset", utils.AppHandler(adminHandler.HandleResetUserPassword))
+				r.With(readAnyActivities).Get("/admin/users/{userId}/activities", utils.AppHandler(adminHandler.HandleGetUserActivities))
+			})
 		})
 	})
     
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// PersonalAccessToken lets scripts and devices call the api on behalf of a
+// user, restricted to its scopes. Only the hash of the token is stored.
+type PersonalAccessToken struct {
+	Id          string             `json:"tokenId" db:"id"`
+	UserId      string             `json:"-" db:"user_id"`
+	Name        string             `json:"name" db:"name"`
+	Scopes      []string           `json:"scopes" db:"scopes"`
+	TokenPrefix string             `json:"tokenPrefix" db:"token_prefix"`
+	TokenHash   string             `json:"-" db:"token_hash"`
+	ExpiresAt   pgtype.Timestamptz `json:"expiresAt" db:"expires_at"`
+	LastUsedAt  pgtype.Timestamptz `json:"lastUsedAt" db:"last_used_at"`
+	RevokedAt   pgtype.Timestamptz `json:"-" db:"revoked_at"`
+	CreatedAt   time.Time          `json:"createdAt" db:"created_at"`
+}
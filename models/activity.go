@@ -1,13 +1,25 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
 
 type Activity struct {
-	Id                string    `json:"activityId" db:"id"`
-	ActivityType      string    `json:"activityType" db:"activity_type"`
-	DoneAt            time.Time `json:"doneAt" db:"done_at"`
-	DurationInMinutes int       `json:"durationInMinutes" db:"duration_in_minutes"`
-	CaloriesBurned    int       `json:"caloriesBurned" db:"calories_burned"`
-	CreatedAt         time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt         time.Time `json:"updatedAt" db:"updated_at"`
+	Id                string      `json:"activityId" db:"id"`
+	ActivityType      string      `json:"activityType" db:"activity_type"`
+	DoneAt            time.Time   `json:"doneAt" db:"done_at"`
+	DurationInMinutes int         `json:"durationInMinutes" db:"duration_in_minutes"`
+	CaloriesBurned    int         `json:"caloriesBurned" db:"calories_burned"`
+	CreatedAt         time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time   `json:"updatedAt" db:"updated_at"`
+	UserId            pgtype.Text `json:"-" db:"user_id"`
+	Version           int         `json:"-" db:"version"`
+	// DeletedAt is set while the activity is in the trash
+	DeletedAt pgtype.Timestamptz `json:"-" db:"deleted_at"`
+	// recorded by devices, unknown for activities entered by hand
+	DistanceInMeters      pgtype.Float8 `json:"-" db:"distance_in_meters"`
+	ElevationGainInMeters pgtype.Float8 `json:"-" db:"elevation_gain_in_meters"`
+	AverageHeartRate      pgtype.Int4   `json:"-" db:"average_heart_rate"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ActivityRevision is one change made to an activity. Before and After only
+// hold the fields that changed, Before is empty for a creation.
+type ActivityRevision struct {
+	Id         string         `json:"revisionId" db:"id"`
+	ActivityId string         `json:"activityId" db:"activity_id"`
+	ActorId    pgtype.Text    `json:"actorId" db:"actor_id"`
+	Action     string         `json:"action" db:"action"`
+	Before     map[string]any `json:"before" db:"before"`
+	After      map[string]any `json:"after" db:"after"`
+	CreatedAt  time.Time      `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type AuditLog struct {
+	Id         string         `json:"auditLogId" db:"id"`
+	ActorId    pgtype.Text    `json:"actorId" db:"actor_id"`
+	Action     string         `json:"action" db:"action"`
+	TargetType pgtype.Text    `json:"targetType" db:"target_type"`
+	TargetId   pgtype.Text    `json:"targetId" db:"target_id"`
+	Ip         pgtype.Text    `json:"ip" db:"ip"`
+	Metadata   map[string]any `json:"metadata" db:"metadata"`
+	CreatedAt  time.Time      `json:"createdAt" db:"created_at"`
+}
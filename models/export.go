@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DataExport is a ZIP archive of everything a user stored, generated in the
+// background.
+type DataExport struct {
+	Id          string             `json:"exportId" db:"id"`
+	UserId      string             `json:"-" db:"user_id"`
+	Status      string             `json:"status" db:"status"`
+	FileKey     pgtype.Text        `json:"-" db:"file_key"`
+	Error       pgtype.Text        `json:"error" db:"error"`
+	CreatedAt   time.Time          `json:"createdAt" db:"created_at"`
+	StartedAt   pgtype.Timestamptz `json:"startedAt" db:"started_at"`
+	CompletedAt pgtype.Timestamptz `json:"completedAt" db:"completed_at"`
+	ExpiresAt   pgtype.Timestamptz `json:"expiresAt" db:"expires_at"`
+}
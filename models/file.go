@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// UploadedFile is an object a user put in the storage backend.
+type UploadedFile struct {
+	Id          string      `json:"fileId" db:"id"`
+	UserId      string      `json:"-" db:"user_id"`
+	Key         string      `json:"key" db:"key"`
+	ContentType pgtype.Text `json:"contentType" db:"content_type"`
+	Size        int64       `json:"size" db:"size"`
+	CreatedAt   time.Time   `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Goal struct {
+	Id           string      `json:"goalId" db:"id"`
+	UserId       string      `json:"-" db:"user_id"`
+	Name         pgtype.Text `json:"name" db:"name"`
+	Metric       string      `json:"metric" db:"metric"`
+	Period       string      `json:"period" db:"period"`
+	Target       int         `json:"target" db:"target"`
+	ActivityType pgtype.Text `json:"activityType" db:"activity_type"`
+	CreatedAt    time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time   `json:"updatedAt" db:"updated_at"`
+}
+
+// GoalProgress is a goal together with what has been achieved in its
+// current period.
+type GoalProgress struct {
+	Goal
+	PeriodStart time.Time `db:"period_start"`
+	PeriodEnd   time.Time `db:"period_end"`
+	Achieved    int       `db:"achieved"`
+}
+
+type GoalPeriod struct {
+	Id          string    `json:"-" db:"id"`
+	GoalId      string    `json:"goalId" db:"goal_id"`
+	PeriodStart time.Time `json:"periodStart" db:"period_start"`
+	PeriodEnd   time.Time `json:"periodEnd" db:"period_end"`
+	Target      int       `json:"target" db:"target"`
+	Achieved    int       `json:"achieved" db:"achieved"`
+	Completed   bool      `json:"completed" db:"completed"`
+	RecordedAt  time.Time `json:"recordedAt" db:"recorded_at"`
+}
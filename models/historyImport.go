@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// HistoryImport is the history exported from another platform, imported in
+// the background.
+type HistoryImport struct {
+	Id                   string             `json:"importId" db:"id"`
+	UserId               string             `json:"-" db:"user_id"`
+	Source               string             `json:"source" db:"source"`
+	FileKey              string             `json:"-" db:"file_key"`
+	Status               string             `json:"status" db:"status"`
+	TotalBytes           int64              `json:"totalBytes" db:"total_bytes"`
+	ProcessedBytes       int64              `json:"processedBytes" db:"processed_bytes"`
+	ProcessedRecords     int                `json:"processedRecords" db:"processed_records"`
+	ImportedActivities   int                `json:"importedActivities" db:"imported_activities"`
+	ImportedMeasurements int                `json:"importedMeasurements" db:"imported_measurements"`
+	SkippedRecords       int                `json:"skippedRecords" db:"skipped_records"`
+	FailedRecords        int                `json:"failedRecords" db:"failed_records"`
+	Error                pgtype.Text        `json:"error" db:"error"`
+	CreatedAt            time.Time          `json:"createdAt" db:"created_at"`
+	StartedAt            pgtype.Timestamptz `json:"startedAt" db:"started_at"`
+	HeartbeatAt          pgtype.Timestamptz `json:"-" db:"heartbeat_at"`
+	CompletedAt          pgtype.Timestamptz `json:"completedAt" db:"completed_at"`
+}
+
+// HistoryImportError is why a record of an import wasn't imported.
+type HistoryImportError struct {
+	Id          int64  `json:"-" db:"id"`
+	ImportId    string `json:"-" db:"import_id"`
+	RecordIndex int    `json:"recordIndex" db:"record_index"`
+	Message     string `json:"message" db:"message"`
+}
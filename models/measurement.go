@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// BodyMeasurement stores weight in kilograms and waist in centimeters.
+type BodyMeasurement struct {
+	Id                string        `db:"id"`
+	UserId            string        `db:"user_id"`
+	MeasuredAt        time.Time     `db:"measured_at"`
+	Weight            pgtype.Float8 `db:"weight"`
+	BodyFatPercentage pgtype.Float8 `db:"body_fat_percentage"`
+	Waist             pgtype.Float8 `db:"waist"`
+	RestingHeartRate  pgtype.Int4   `db:"resting_heart_rate"`
+	CreatedAt         time.Time     `db:"created_at"`
+}
+
+// BodyMeasurementAverage holds the averages of the measurements taken in the
+// day or week starting at BucketStart.
+type BodyMeasurementAverage struct {
+	BucketStart       time.Time     `db:"bucket_start"`
+	Weight            pgtype.Float8 `db:"weight"`
+	BodyFatPercentage pgtype.Float8 `db:"body_fat_percentage"`
+	Waist             pgtype.Float8 `db:"waist"`
+	RestingHeartRate  pgtype.Float8 `db:"resting_heart_rate"`
+	Count             int           `db:"count"`
+}
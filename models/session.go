@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Session is a login of a user on a device, lasting as long as its access
+// token unless revoked.
+type Session struct {
+	Id         string             `json:"sessionId" db:"id"`
+	UserId     string             `json:"-" db:"user_id"`
+	DeviceName pgtype.Text        `json:"deviceName" db:"device_name"`
+	UserAgent  pgtype.Text        `json:"userAgent" db:"user_agent"`
+	Ip         pgtype.Text        `json:"ip" db:"ip"`
+	CreatedAt  time.Time          `json:"createdAt" db:"created_at"`
+	LastSeenAt time.Time          `json:"lastSeenAt" db:"last_seen_at"`
+	ExpiresAt  time.Time          `json:"expiresAt" db:"expires_at"`
+	RevokedAt  pgtype.Timestamptz `json:"-" db:"revoked_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type StreakSettings struct {
+	UserId           string    `json:"-" db:"user_id"`
+	RestDaysPerWeek  int       `json:"restDaysPerWeek" db:"rest_days_per_week"`
+	WeeklyActiveDays int       `json:"weeklyActiveDays" db:"weekly_active_days"`
+	UpdatedAt        time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Streak is a run of consecutive active days or weeks. Length is counted in
+// the unit of the streak and is zero when there is no run.
+type Streak struct {
+	Length    int
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+type Streaks struct {
+	CurrentDaily  Streak
+	LongestDaily  Streak
+	CurrentWeekly Streak
+	LongestWeekly Streak
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// UserToken is a single-use token mailed to a user, e.g. to reset a password.
+// Only the hash of the token is stored.
+type UserToken struct {
+	Id        string `db:"id"`
+	UserId    string `db:"user_id"`
+	Purpose   string `db:"purpose"`
+	TokenHash string `db:"token_hash"`
+	// Email is the new address an email change token confirms
+	Email     pgtype.Text        `db:"email"`
+	ExpiresAt time.Time          `db:"expires_at"`
+	UsedAt    pgtype.Timestamptz `db:"used_at"`
+	CreatedAt time.Time          `db:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TrackPoint is a sample recorded by a device during an activity.
+type TrackPoint struct {
+	ActivityId string        `json:"-" db:"activity_id"`
+	RecordedAt time.Time     `json:"recordedAt" db:"recorded_at"`
+	Latitude   pgtype.Float8 `json:"latitude" db:"latitude"`
+	Longitude  pgtype.Float8 `json:"longitude" db:"longitude"`
+	Elevation  pgtype.Float8 `json:"elevation" db:"elevation"`
+	HeartRate  pgtype.Int4   `json:"heartRate" db:"heart_rate"`
+	Power      pgtype.Int4   `json:"power" db:"power"`
+}
@@ -3,15 +3,26 @@ package models
 import "github.com/jackc/pgx/v5/pgtype"
 
 type User struct {
-	Id         string      `json:"id" db:"id"`
-	Email      string      `json:"email" db:"email"`
-	Password   string      `json:"-" db:"password"`
-	Token      string      `json:"token" db:"-"`
-	Preference pgtype.Text `json:"preference" db:"preference"`
-	WeightUnit pgtype.Text `json:"WeightUnit" db:"weight_unit"`
-	HeightUnit pgtype.Text `json:"HeightUnit" db:"height_unit"`
-	Weight     pgtype.Int4 `json:"weight" db:"weight"`
-	Height     pgtype.Int4 `json:"height" db:"height"`
-	Name       pgtype.Text `json:"name" db:"name"`
-	ImageUri   pgtype.Text `json:"imageUri" db:"image_uri"`
+	Id         string        `json:"id" db:"id"`
+	Email      string        `json:"email" db:"email"`
+	Password   string        `json:"-" db:"password"`
+	Token      string        `json:"token" db:"-"`
+	Preference pgtype.Text   `json:"preference" db:"preference"`
+	WeightUnit pgtype.Text   `json:"WeightUnit" db:"weight_unit"`
+	HeightUnit pgtype.Text   `json:"HeightUnit" db:"height_unit"`
+	Weight     pgtype.Float8 `json:"weight" db:"weight"`
+	Height     pgtype.Float8 `json:"height" db:"height"`
+	Name       pgtype.Text   `json:"name" db:"name"`
+	ImageUri   pgtype.Text   `json:"imageUri" db:"image_uri"`
+	Timezone   string        `json:"timezone" db:"timezone"`
+	Role       string        `json:"role" db:"role"`
+
+	EmailVerifiedAt pgtype.Timestamptz `json:"-" db:"email_verified_at"`
+	TotpSecret      pgtype.Text        `json:"-" db:"totp_secret"`
+	TotpEnabledAt   pgtype.Timestamptz `json:"-" db:"totp_enabled_at"`
+	TotpLastCounter int64              `json:"-" db:"totp_last_counter"`
+	DisabledAt      pgtype.Timestamptz `json:"-" db:"disabled_at"`
+	Version         int                `json:"-" db:"version"`
+
+	DeletionScheduledAt pgtype.Timestamptz `json:"-" db:"deletion_scheduled_at"`
 }
@@ -0,0 +1,217 @@
+// Package password hashes passwords and checks them against the password
+// policy.
+//
+// Hashes carry their algorithm and parameters, bcrypt ones in the "$2a$"
+// format and Argon2id ones in the PHC format
+// "$argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>", so
+// raising the cost or switching algorithm only applies to new hashes. Legacy
+// hashes keep working and are replaced when their owner logs in, see
+// Hasher.Verify.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Params are the algorithm new hashes are made with and its cost. The
+// defaults follow the OWASP recommendations.
+type Params struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is in KiB
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+var DefaultParams = Params{
+	Algorithm:         Argon2id,
+	BcryptCost:        10,
+	Argon2Memory:      19 * 1024,
+	Argon2Iterations:  2,
+	Argon2Parallelism: 1,
+}
+
+type Hasher struct {
+	params Params
+}
+
+func NewHasher(params Params) (*Hasher, error) {
+	switch params.Algorithm {
+	case Bcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case Argon2id:
+		if params.Argon2Memory == 0 || params.Argon2Iterations == 0 || params.Argon2Parallelism == 0 {
+			return nil, errors.New("argon2id memory, iterations and parallelism must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", params.Algorithm)
+	}
+
+	return &Hasher{params}, nil
+}
+
+// NewHasherFromEnv overrides the default params with PASSWORD_HASH_ALGORITHM,
+// BCRYPT_COST, ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM.
+func NewHasherFromEnv() (*Hasher, error) {
+	params := DefaultParams
+	if algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm != "" {
+		params.Algorithm = algorithm
+	}
+
+	var err error
+	if params.BcryptCost, err = envInt("BCRYPT_COST", params.BcryptCost); err != nil {
+		return nil, err
+	}
+	memory, err := envInt("ARGON2_MEMORY_KIB", int(params.Argon2Memory))
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := envInt("ARGON2_ITERATIONS", int(params.Argon2Iterations))
+	if err != nil {
+		return nil, err
+	}
+	parallelism, err := envInt("ARGON2_PARALLELISM", int(params.Argon2Parallelism))
+	if err != nil {
+		return nil, err
+	}
+	if memory < 0 || iterations < 0 || parallelism < 0 || parallelism > 255 {
+		return nil, errors.New("argon2id params are out of range")
+	}
+	params.Argon2Memory = uint32(memory)
+	params.Argon2Iterations = uint32(iterations)
+	params.Argon2Parallelism = uint8(parallelism)
+
+	return NewHasher(params)
+}
+
+func envInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+
+	return n, nil
+}
+
+// Algorithm is the one new hashes are made with.
+func (h *Hasher) Algorithm() string {
+	return h.params.Algorithm
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.params.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	params := argon2Params{
+		memory:      h.params.Argon2Memory,
+		iterations:  h.params.Argon2Iterations,
+		parallelism: h.params.Argon2Parallelism,
+	}
+	key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify tells whether password matches hash and, when it does, whether hash
+// was made with another algorithm or cost than the current ones and should be
+// replaced by a new Hash of password.
+func (h *Hasher) Verify(hash string, password string) (match bool, needsRehash bool) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := parseArgon2(hash)
+		if err != nil {
+			return false, false
+		}
+
+		otherKey := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+			return false, false
+		}
+
+		return true, h.params.Algorithm != Argon2id ||
+			params.memory != h.params.Argon2Memory ||
+			params.iterations != h.params.Argon2Iterations ||
+			params.parallelism != h.params.Argon2Parallelism
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	return true, err != nil || h.params.Algorithm != Bcrypt || cost != h.params.BcryptCost
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func parseArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	params := argon2Params{}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	return params, salt, key, nil
+}
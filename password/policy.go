@@ -0,0 +1,118 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcryptMaxLength is the number of bytes bcrypt reads, the rest of a password
+// is silently ignored.
+const bcryptMaxLength = 72
+
+// Policy is what new passwords must comply with.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// maxBytes is set with bcrypt, which doesn't read past bcryptMaxLength
+	maxBytes int
+	// breached holds the uppercase hex SHA-1 of known leaked passwords
+	breached map[string]struct{}
+}
+
+// NewPolicyFromEnv reads PASSWORD_MIN_LENGTH (8 by default),
+// PASSWORD_MAX_LENGTH (128 by default, at most 72 bytes with bcrypt) and
+// PASSWORD_BREACHED_LIST, a file of leaked passwords, one per line, either in
+// plain text or as the SHA-1 hashes of the Have I Been Pwned downloads
+// ("<hash>:<count>").
+func NewPolicyFromEnv(hasher *Hasher) (Policy, error) {
+	policy := Policy{}
+
+	var err error
+	if policy.MinLength, err = envInt("PASSWORD_MIN_LENGTH", 8); err != nil {
+		return policy, err
+	}
+	if policy.MaxLength, err = envInt("PASSWORD_MAX_LENGTH", 128); err != nil {
+		return policy, err
+	}
+	if policy.MinLength < 1 || policy.MaxLength < policy.MinLength {
+		return policy, errors.New("PASSWORD_MIN_LENGTH must be positive and at most PASSWORD_MAX_LENGTH")
+	}
+	if hasher.Algorithm() == Bcrypt && policy.MinLength > bcryptMaxLength {
+		return policy, fmt.Errorf("bcrypt only reads the first %d bytes of passwords", bcryptMaxLength)
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		if policy.breached, err = loadBreachedList(path); err != nil {
+			return policy, err
+		}
+	}
+	if hasher.Algorithm() == Bcrypt {
+		policy.maxBytes = bcryptMaxLength
+	}
+
+	return policy, nil
+}
+
+func loadBreachedList(path string) (map[string]struct{}, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the breached passwords list: %v", err)
+	}
+	defer file.Close()
+
+	breached := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		if len(hash) != sha1.Size*2 || !isHex(hash) {
+			hash = sha1Hex(line)
+		}
+		breached[strings.ToUpper(hash)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the breached passwords list: %v", err)
+	}
+
+	return breached, nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Check returns why password can't be used, nil when it can.
+func (p Policy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if length > p.MaxLength {
+		return fmt.Errorf("password must be at most %d characters long", p.MaxLength)
+	}
+	if p.maxBytes > 0 && len(password) > p.maxBytes {
+		return fmt.Errorf("password must be at most %d bytes long", p.maxBytes)
+	}
+
+	if _, ok := p.breached[sha1Hex(password)]; ok {
+		return errors.New("password is known to have leaked, choose another one")
+	}
+
+	return nil
+}
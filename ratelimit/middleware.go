@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"fit-byte/utils"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+// KeyFunc names the client a request is counted against.
+type KeyFunc func(r *http.Request) string
+
+func ByIP(r *http.Request) string {
+	return "ip:" + utils.GetClientIP(r)
+}
+
+// ByUserId counts requests per authenticated user, or per ip for anonymous
+// ones. It must run after the jwt verifier.
+func ByUserId(r *http.Request) string {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err == nil {
+		if userId, ok := claims["userId"].(string); ok {
+			return "user:" + userId
+		}
+	}
+
+	return ByIP(r)
+}
+
+// ByAPIKey counts requests per personal access token, so every integration
+// gets its own bucket, and falls back to ByUserId for the user's own session.
+// It must run after the access token verifier.
+func ByAPIKey(r *http.Request) string {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err == nil {
+		if tokenId, ok := claims["tokenId"].(string); ok {
+			return "key:" + tokenId
+		}
+	}
+
+	return ByUserId(r)
+}
+
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+}
+
+func NewLimiter(store Store, policies map[string]Policy) *Limiter {
+	return &Limiter{store, policies}
+}
+
+// DeleteFullBuckets drops the buckets full again of every policy, they count
+// for nothing anymore.
+func (l *Limiter) DeleteFullBuckets(ctx context.Context) error {
+	for _, policy := range l.policies {
+		if err := l.store.DeleteFull(ctx, policy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Limit applies the named policy, falling back to the "default" one, to every
+// client told apart by keyFunc. Responses carry the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, and Retry-After once the
+// client is limited.
+func (l *Limiter) Limit(policyName string, keyFunc KeyFunc) func(http.Handler) http.Handler {
+	policy, ok := l.policies[policyName]
+	if !ok {
+		policy = l.policies["default"]
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := l.store.Take(r.Context(), policy.Name+":"+keyFunc(r), policy)
+			if err != nil {
+				// a broken store shouldn't take the whole api down
+				log.Println("Error taking rate limit token:", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			resetAfter := (float64(policy.Limit) - result.Tokens) / policy.rate()
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(result.Tokens)))))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(resetAfter))))
+
+			if !result.Allowed {
+				retryAfter := (1 - result.Tokens) / policy.rate()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
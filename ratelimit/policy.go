@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a token bucket holding up to Limit tokens, refilled at Limit
+// tokens per Period. Every request takes one token.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// rate is the number of tokens added back per second.
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// DefaultPolicies are used for the routes RATE_LIMIT_POLICIES doesn't cover.
+var DefaultPolicies = map[string]Policy{
+	"default":  {Name: "default", Limit: 300, Period: time.Minute},
+	"register": {Name: "register", Limit: 5, Period: time.Hour},
+	"login":    {Name: "login", Limit: 10, Period: time.Minute},
+	"file":     {Name: "file", Limit: 20, Period: time.Minute},
+	"email":    {Name: "email", Limit: 5, Period: time.Hour},
+}
+
+// ParsePolicies reads policies like "login=10/1m,file=20/1m" on top of
+// DefaultPolicies.
+func ParsePolicies(spec string) (map[string]Policy, error) {
+	policies := make(map[string]Policy, len(DefaultPolicies))
+	for name, policy := range DefaultPolicies {
+		policies[name] = policy
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(part, "=")
+		limitStr, periodStr, foundPeriod := strings.Cut(value, "/")
+		if !found || !foundPeriod {
+			return nil, fmt.Errorf("invalid rate limit policy %q, expected name=limit/period", part)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit in rate limit policy %q", part)
+		}
+		period, err := time.ParseDuration(strings.TrimSpace(periodStr))
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("invalid period in rate limit policy %q", part)
+		}
+
+		name = strings.TrimSpace(name)
+		policies[name] = Policy{Name: name, Limit: limit, Period: period}
+	}
+
+	return policies, nil
+}
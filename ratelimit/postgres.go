@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore shares the buckets between every instance of the server.
+type PostgresStore struct {
+	pgConn *pgxpool.Pool
+}
+
+func NewPostgresStore(pgConn *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pgConn}
+}
+
+// refillExpression is the content of the existing bucket once refilled. In
+// the SET clause of the upsert it reads the locked, latest version of the row,
+// which makes refill and take atomic.
+const refillExpression = `LEAST(
+	@limit::double precision,
+	rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - rate_limit_buckets.updated_at)) * @rate::double precision
+)`
+
+func (s *PostgresStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	query := `
+	INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+	VALUES (@key, @limit::double precision - 1, true, CURRENT_TIMESTAMP)
+	ON CONFLICT (key) DO UPDATE SET
+		tokens = CASE
+			WHEN ` + refillExpression + ` >= 1 THEN ` + refillExpression + ` - 1
+			ELSE ` + refillExpression + `
+		END,
+		allowed = ` + refillExpression + ` >= 1,
+		updated_at = CURRENT_TIMESTAMP
+	RETURNING allowed, tokens
+	`
+	args := pgx.NamedArgs{
+		"key":   key,
+		"limit": policy.Limit,
+		"rate":  policy.rate(),
+	}
+
+	var result Result
+	err := s.pgConn.QueryRow(ctx, query, args).Scan(&result.Allowed, &result.Tokens)
+
+	return result, err
+}
+
+func (s *PostgresStore) DeleteFull(ctx context.Context, policy Policy) error {
+	query := `
+	DELETE FROM rate_limit_buckets
+	WHERE starts_with(key, @prefix)
+		AND tokens + EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - updated_at)) * @rate::double precision >= @limit::double precision
+	`
+	args := pgx.NamedArgs{
+		"prefix": policy.Name + ":",
+		"limit":  policy.Limit,
+		"rate":   policy.rate(),
+	}
+
+	_, err := s.pgConn.Exec(ctx, query, args)
+
+	return err
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps the token buckets. Take refills the bucket of key according to
+// policy, then takes one token out of it if there is one, atomically.
+// DeleteFull drops the buckets of policy that are full again, a client without
+// a bucket gets a full one anyway.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+	DeleteFull(ctx context.Context, policy Policy) error
+}
+
+type Result struct {
+	Allowed bool
+	// Tokens left in the bucket after the request
+	Tokens float64
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// MemoryStore keeps buckets in the process. Each instance of the server then
+// has its own limits, use PostgresStore when running several of them.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(policy.Limit), updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = min(float64(policy.Limit), b.tokens+now.Sub(b.updatedAt).Seconds()*policy.rate())
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return Result{Allowed: false, Tokens: b.tokens}, nil
+	}
+
+	b.tokens--
+	return Result{Allowed: true, Tokens: b.tokens}, nil
+}
+
+func (s *MemoryStore) DeleteFull(ctx context.Context, policy Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, b := range s.buckets {
+		if !strings.HasPrefix(key, policy.Name+":") {
+			continue
+		}
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*policy.rate() >= float64(policy.Limit) {
+			delete(s.buckets, key)
+		}
+	}
+
+	return nil
+}
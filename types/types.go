@@ -9,12 +9,13 @@ type UpdateUserPayload struct {
 	Preference  *string         `json:"preference" db:"preference" validate:"oneof=CARDIO WEIGHT"`
 	WeightUnit  *string         `json:"weightUnit" db:"weight_unit" validate:"oneof=KG LBS"`
 	HeightUnit  *string         `json:"heightUnit" db:"height_unit" validate:"oneof=CM INCH"`
-	Weight      *int            `json:"weight" db:"weight" validate:"gte=10,lte=1000"`
-	Height      *int            `json:"height" db:"height" validate:"gte=3,lte=250"`
+	Weight      *float64        `json:"weight" db:"weight" validate:"gte=10,lte=1000"`
+	Height      *float64        `json:"height" db:"height" validate:"gte=3,lte=250"`
 	NameRaw     json.RawMessage `json:"name,omitempty"`
 	Name        *string         `db:"name" validate:"omitempty,min=2,max=60"`
 	ImageUriRaw json.RawMessage `json:"imageUri,omitempty"`
 	ImageUri    *string         `db:"image_uri" validate:"omitempty,uri"`
+	Timezone    *string         `json:"timezone" db:"timezone" validate:"omitempty,timezone"`
 }
 
 type UpdateActivityPayload struct {
@@ -25,3 +26,19 @@ type UpdateActivityPayload struct {
 	DurationInMinutes *int            `json:"durationInMinutes,omitempty" db:"duration_in_minutes" validate:"omitempty,min=1"`
 	CaloriesBurned    *int             `json:"-" db:"calories_burned"`
 }
+
+// BatchUpdateActivityPayload is one update of a batch, along with the
+// activity it applies to.
+type BatchUpdateActivityPayload struct {
+	ActivityId string `json:"activityId" validate:"required"`
+	UpdateActivityPayload
+}
+
+// CustomTime serializes a time as UTC with millisecond precision, whatever
+// location it was read in.
+type CustomTime time.Time
+
+func (ct CustomTime) MarshalJSON() ([]byte, error) {
+	t := time.Time(ct).UTC()
+	return []byte(`"` + t.Format("2006-01-02T15:04:05.000Z") + `"`), nil
+}
@@ -0,0 +1,133 @@
+package units
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	KG   string = "KG"
+	LBS  string = "LBS"
+	CM   string = "CM"
+	INCH string = "INCH"
+
+	M  string = "M"
+	KM string = "KM"
+	MI string = "MI"
+
+	SECONDS string = "SECONDS"
+	MINUTES string = "MINUTES"
+	HOURS   string = "HOURS"
+
+	KG_PER_LB     float64 = 0.45359237
+	CM_PER_INCH   float64 = 2.54
+	METERS_PER_MI float64 = 1609.344
+)
+
+// Preferences are the units weights and heights are presented in. Values are
+// always stored in KG and CM.
+type Preferences struct {
+	Weight string
+	Height string
+}
+
+var Metric = Preferences{Weight: KG, Height: CM}
+var Imperial = Preferences{Weight: LBS, Height: INCH}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// ToKg converts a weight expressed in unit into kilograms.
+func ToKg(value float64, unit string) float64 {
+	if unit == LBS {
+		return round(value * KG_PER_LB)
+	}
+
+	return round(value)
+}
+
+// FromKg converts a weight in kilograms into unit.
+func FromKg(value float64, unit string) float64 {
+	if unit == LBS {
+		return round(value / KG_PER_LB)
+	}
+
+	return round(value)
+}
+
+// ToCm converts a length expressed in unit into centimeters.
+func ToCm(value float64, unit string) float64 {
+	if unit == INCH {
+		return round(value * CM_PER_INCH)
+	}
+
+	return round(value)
+}
+
+// FromCm converts a length in centimeters into unit.
+func FromCm(value float64, unit string) float64 {
+	if unit == INCH {
+		return round(value / CM_PER_INCH)
+	}
+
+	return round(value)
+}
+
+// ToMeters converts a distance expressed in unit into meters.
+func ToMeters(value float64, unit string) float64 {
+	switch unit {
+	case KM:
+		return round(value * 1000)
+	case MI:
+		return round(value * METERS_PER_MI)
+	}
+
+	return round(value)
+}
+
+// ToMinutes converts a duration expressed in unit into minutes.
+func ToMinutes(value float64, unit string) float64 {
+	switch unit {
+	case SECONDS:
+		return value / 60
+	case HOURS:
+		return value * 60
+	}
+
+	return value
+}
+
+// ParseAcceptUnits applies an Accept-Units header on top of prefs. The header
+// is a comma separated list of either "metric", "imperial" or unit overrides
+// like "weight=LBS". Unknown entries are ignored.
+func ParseAcceptUnits(header string, prefs Preferences) Preferences {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.ToUpper(strings.TrimSpace(part))
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			switch key {
+			case "METRIC":
+				prefs = Metric
+			case "IMPERIAL":
+				prefs = Imperial
+			}
+			continue
+		}
+
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case key == "WEIGHT" && (value == KG || value == LBS):
+			prefs.Weight = value
+		case key == "HEIGHT" && (value == CM || value == INCH):
+			prefs.Height = value
+		}
+	}
+
+	return prefs
+}
+
+// String formats prefs the way ParseAcceptUnits reads them.
+func (p Preferences) String() string {
+	return "weight=" + p.Weight + ", height=" + p.Height
+}
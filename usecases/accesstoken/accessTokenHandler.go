@@ -0,0 +1,146 @@
+package accesstoken
+
+import (
+	"encoding/json"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+type AccessTokenHandler struct {
+	accessTokenService AccessTokenService
+}
+
+func NewAccessTokenHandler(accessTokenService AccessTokenService) AccessTokenHandler {
+	return AccessTokenHandler{accessTokenService}
+}
+
+// Verifier authenticates requests bearing a personal access token. It runs
+// after the jwt verifier and replaces what that one put in the context, with
+// a token holding the userId and scopes claims, so handlers and
+// utils.RequireScope don't tell them apart.
+func (h *AccessTokenHandler) Verifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plainToken := jwtauth.TokenFromHeader(r)
+		if !strings.HasPrefix(plainToken, constants.ACCESS_TOKEN_PREFIX) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		accessToken, err := h.accessTokenService.Authenticate(plainToken)
+		if err != nil {
+			if _, ok := err.(*models.AppError); !ok {
+				log.Println("Error authenticating access token:", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), nil, jwtauth.ErrUnauthorized)))
+			return
+		}
+
+		token := jwt.New()
+		token.Set("userId", accessToken.UserId)
+		token.Set("tokenId", accessToken.Id)
+		token.Set("scopes", accessToken.Scopes)
+
+		next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, nil)))
+	})
+}
+
+func (h *AccessTokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Name      string     `json:"name" validate:"required,min=2,max=60"`
+		Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=activity:read activity:write profile:read profile:write"`
+		ExpiresAt *time.Time `json:"expiresAt" validate:"omitempty"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		return models.NewError(http.StatusBadRequest, "validation for 'ExpiresAt' failed")
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	accessToken := models.PersonalAccessToken{
+		UserId: userId,
+		Name:   payload.Name,
+		Scopes: payload.Scopes,
+	}
+	if payload.ExpiresAt != nil {
+		accessToken.ExpiresAt = pgtype.Timestamptz{Time: *payload.ExpiresAt, Valid: true}
+	}
+
+	newToken, plainToken, err := h.accessTokenService.CreateToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		models.PersonalAccessToken
+		Token string `json:"token"`
+	}{
+		PersonalAccessToken: *newToken,
+		Token:               plainToken,
+	}
+	utils.SetJsonResponse(w, http.StatusCreated, res)
+
+	return nil
+}
+
+func (h *AccessTokenHandler) HandleGetTokens(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	tokens, err := h.accessTokenService.GetTokens(userId)
+	if err != nil {
+		return err
+	}
+
+	utils.SetJsonResponse(w, http.StatusOK, tokens)
+
+	return nil
+}
+
+func (h *AccessTokenHandler) HandleRevokeToken(w http.ResponseWriter, r *http.Request) error {
+	tokenId := r.PathValue("tokenId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	err = h.accessTokenService.RevokeToken(tokenId, userId)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package accesstoken
+
+import (
+	"context"
+	"fit-byte/models"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AccessTokenRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewAccessTokenRepository(ctx context.Context, pgConn *pgxpool.Pool) AccessTokenRepository {
+	return AccessTokenRepository{ctx, pgConn}
+}
+
+func (r *AccessTokenRepository) Save(token models.PersonalAccessToken) (*models.PersonalAccessToken, error) {
+	query := `
+	INSERT INTO personal_access_tokens (
+		user_id,
+		name,
+		scopes,
+		token_prefix,
+		token_hash,
+		expires_at
+	)
+	VALUES (
+		@user_id,
+		@name,
+		@scopes,
+		@token_prefix,
+		@token_hash,
+		@expires_at
+	)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"user_id":      token.UserId,
+		"name":         token.Name,
+		"scopes":       token.Scopes,
+		"token_prefix": token.TokenPrefix,
+		"token_hash":   token.TokenHash,
+		"expires_at":   token.ExpiresAt,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	newToken, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.PersonalAccessToken])
+	if err != nil {
+		return nil, err
+	}
+
+	return &newToken, nil
+}
+
+// FindAllByUserId returns the tokens that haven't been revoked, expired ones
+// included so users can tell why a script stopped working.
+func (r *AccessTokenRepository) FindAllByUserId(userId string) ([]models.PersonalAccessToken, error) {
+	query := `
+	SELECT *
+	FROM personal_access_tokens
+	WHERE user_id = @user_id AND revoked_at IS NULL
+	ORDER BY created_at DESC
+	`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.PersonalAccessToken])
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Use returns the token having tokenHash and records that it was just used,
+// as long as it is neither revoked nor expired. It returns pgx.ErrNoRows
+// otherwise.
+func (r *AccessTokenRepository) Use(tokenHash string) (*models.PersonalAccessToken, error) {
+	query := `
+	UPDATE personal_access_tokens
+	SET last_used_at = CURRENT_TIMESTAMP
+	WHERE token_hash = @token_hash
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"token_hash": tokenHash,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	token, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.PersonalAccessToken])
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *AccessTokenRepository) Revoke(id string, userId string) error {
+	query := `
+	UPDATE personal_access_tokens
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE id = @id AND user_id = @user_id AND revoked_at IS NULL
+	`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return models.NewError(http.StatusNotFound, "")
+	}
+
+	return nil
+}
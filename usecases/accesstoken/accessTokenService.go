@@ -0,0 +1,77 @@
+package accesstoken
+
+import (
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/utils"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type AccessTokenService struct {
+	accessTokenRepository AccessTokenRepository
+}
+
+func NewAccessTokenService(accessTokenRepository AccessTokenRepository) AccessTokenService {
+	return AccessTokenService{accessTokenRepository}
+}
+
+// CreateToken stores a new token for token.UserId and returns it along with
+// the token in plain text, which can't be retrieved afterwards.
+func (s *AccessTokenService) CreateToken(token models.PersonalAccessToken) (*models.PersonalAccessToken, string, error) {
+	secret, err := utils.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	plainToken := constants.ACCESS_TOKEN_PREFIX + secret
+
+	token.TokenPrefix = plainToken[:len(constants.ACCESS_TOKEN_PREFIX)+8]
+	token.TokenHash = utils.HashToken(plainToken)
+
+	newToken, err := s.accessTokenRepository.Save(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return newToken, plainToken, nil
+}
+
+func (s *AccessTokenService) GetTokens(userId string) ([]models.PersonalAccessToken, error) {
+	return s.accessTokenRepository.FindAllByUserId(userId)
+}
+
+func (s *AccessTokenService) RevokeToken(id string, userId string) error {
+	err := s.accessTokenRepository.Revoke(id, userId)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return models.NewError(http.StatusNotFound, "")
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Authenticate returns the token matching plainToken, or a 401 when it is
+// unknown, revoked or expired.
+func (s *AccessTokenService) Authenticate(plainToken string) (*models.PersonalAccessToken, error) {
+	if !strings.HasPrefix(plainToken, constants.ACCESS_TOKEN_PREFIX) {
+		return nil, models.NewError(http.StatusUnauthorized, "Invalid access token")
+	}
+
+	token, err := s.accessTokenRepository.Use(utils.HashToken(plainToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NewError(http.StatusUnauthorized, "Invalid access token")
+		}
+
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,129 @@
+package account
+
+import (
+	"encoding/json"
+	"fit-byte/models"
+	"fit-byte/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type AccountHandler struct {
+	accountService AccountService
+}
+
+func NewAccountHandler(accountService AccountService) AccountHandler {
+	return AccountHandler{accountService}
+}
+
+func (h *AccountHandler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Password string `json:"password" validate:"required"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	deletionAt, err := h.accountService.RequestDeletion(userId, payload.Password)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		DeletionScheduledAt string `json:"deletionScheduledAt"`
+	}{
+		DeletionScheduledAt: formatTime(deletionAt),
+	}
+	utils.SetJsonResponse(w, http.StatusAccepted, res)
+
+	return nil
+}
+
+func (h *AccountHandler) HandleCancelDeletion(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	if err := h.accountService.CancelDeletion(userId); err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
+
+func (h *AccountHandler) HandleRequestExport(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	export, err := h.accountService.RequestExport(userId)
+	if err != nil {
+		return err
+	}
+	utils.SetJsonResponse(w, http.StatusAccepted, export)
+
+	return nil
+}
+
+func (h *AccountHandler) HandleGetExports(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	exports, err := h.accountService.GetExports(userId)
+	if err != nil {
+		return err
+	}
+	utils.SetJsonResponse(w, http.StatusOK, exports)
+
+	return nil
+}
+
+func (h *AccountHandler) HandleGetExport(w http.ResponseWriter, r *http.Request) error {
+	exportId := r.PathValue("exportId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	export, downloadUrl, err := h.accountService.GetExport(exportId, userId)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		*models.DataExport
+		DownloadUrl string `json:"downloadUrl,omitempty"`
+	}{
+		DataExport:  export,
+		DownloadUrl: downloadUrl,
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
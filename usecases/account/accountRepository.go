@@ -0,0 +1,312 @@
+package account
+
+import (
+	"context"
+	"fit-byte/models"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AccountRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewAccountRepository(ctx context.Context, pgConn *pgxpool.Pool) AccountRepository {
+	return AccountRepository{ctx, pgConn}
+}
+
+func (r *AccountRepository) ScheduleDeletion(userId string, at time.Time) error {
+	query := `UPDATE users SET deletion_scheduled_at = @at WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": userId,
+		"at": at,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+func (r *AccountRepository) CancelDeletion(userId string) error {
+	query := `UPDATE users SET deletion_scheduled_at = NULL WHERE id = @id AND deletion_scheduled_at IS NOT NULL`
+	args := pgx.NamedArgs{
+		"id": userId,
+	}
+
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return models.NewError(http.StatusConflict, "Account deletion isn't scheduled")
+	}
+
+	return nil
+}
+
+// FindDueForDeletion returns the users whose grace period is over.
+func (r *AccountRepository) FindDueForDeletion() ([]models.User, error) {
+	query := `SELECT * FROM users WHERE deletion_scheduled_at <= CURRENT_TIMESTAMP`
+
+	rows, err := r.pgConn.Query(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.User])
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// DeleteUser deletes the user, along with everything they own, unless the
+// deletion was cancelled in the meantime. It returns whether it did.
+func (r *AccountRepository) DeleteUser(userId string) (bool, error) {
+	query := `DELETE FROM users WHERE id = @id AND deletion_scheduled_at <= CURRENT_TIMESTAMP`
+	args := pgx.NamedArgs{
+		"id": userId,
+	}
+
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (r *AccountRepository) FindActivities(userId string) ([]models.Activity, error) {
+	query := `SELECT * FROM activities WHERE user_id = @user_id AND deleted_at IS NULL ORDER BY done_at`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Activity])
+}
+
+// ForEachTrackPoint calls fn with the track points of the user's activities,
+// one activity after the other. They can be many, so they are streamed.
+func (r *AccountRepository) ForEachTrackPoint(userId string, fn func(models.TrackPoint) error) error {
+	query := `
+	SELECT tp.* FROM activity_track_points tp
+	JOIN activities a ON a.id = tp.activity_id
+	WHERE a.user_id = @user_id AND a.deleted_at IS NULL
+	ORDER BY a.done_at, tp.activity_id, tp.recorded_at
+	`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		point, err := pgx.RowToStructByName[models.TrackPoint](rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(point); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (r *AccountRepository) FindMeasurements(userId string) ([]models.BodyMeasurement, error) {
+	query := `SELECT * FROM body_measurements WHERE user_id = @user_id ORDER BY measured_at`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.BodyMeasurement])
+}
+
+func (r *AccountRepository) FindGoals(userId string) ([]models.Goal, error) {
+	query := `SELECT * FROM goals WHERE user_id = @user_id ORDER BY created_at`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Goal])
+}
+
+// SaveExport queues an export, unless the user already has one queued or
+// running.
+func (r *AccountRepository) SaveExport(userId string) (*models.DataExport, error) {
+	query := `
+	INSERT INTO data_exports (user_id)
+	SELECT @user_id
+	WHERE NOT EXISTS (
+		SELECT 1 FROM data_exports
+		WHERE user_id = @user_id AND status IN ('PENDING', 'RUNNING')
+	)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	export, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.DataExport])
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+func (r *AccountRepository) FindExports(userId string) ([]models.DataExport, error) {
+	query := `SELECT * FROM data_exports WHERE user_id = @user_id ORDER BY created_at DESC`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.DataExport])
+}
+
+func (r *AccountRepository) FindExport(id string, userId string) (*models.DataExport, error) {
+	query := `SELECT * FROM data_exports WHERE id = @id AND user_id = @user_id`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	export, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.DataExport])
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// ClaimExport marks the oldest queued export as running and returns it, or
+// returns pgx.ErrNoRows when there is none. Exports left running for longer
+// than staleAfter, by an instance that died, are claimed again.
+func (r *AccountRepository) ClaimExport(staleAfter time.Duration) (*models.DataExport, error) {
+	query := `
+	UPDATE data_exports
+	SET status = 'RUNNING', started_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id FROM data_exports
+		WHERE status = 'PENDING'
+			OR (status = 'RUNNING' AND started_at < CURRENT_TIMESTAMP - @stale_after::interval)
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"stale_after": staleAfter,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	export, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.DataExport])
+	if err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+func (r *AccountRepository) CompleteExport(id string, fileKey string, expiresAt time.Time) error {
+	query := `
+	UPDATE data_exports
+	SET status = 'DONE', file_key = @file_key, completed_at = CURRENT_TIMESTAMP, expires_at = @expires_at
+	WHERE id = @id
+	`
+	args := pgx.NamedArgs{
+		"id":         id,
+		"file_key":   fileKey,
+		"expires_at": expiresAt,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+func (r *AccountRepository) FailExport(id string, message string) error {
+	query := `
+	UPDATE data_exports
+	SET status = 'FAILED', error = @error, completed_at = CURRENT_TIMESTAMP
+	WHERE id = @id
+	`
+	args := pgx.NamedArgs{
+		"id":    id,
+		"error": message,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+// FindExportFileKeys returns the archives of the user's exports, expired ones
+// included.
+func (r *AccountRepository) FindExportFileKeys(userId string) ([]string, error) {
+	query := `SELECT file_key FROM data_exports WHERE user_id = @user_id AND file_key IS NOT NULL`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (r *AccountRepository) FindExpiredExports() ([]models.DataExport, error) {
+	query := `SELECT * FROM data_exports WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	rows, err := r.pgConn.Query(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.DataExport])
+}
+
+func (r *AccountRepository) DeleteExport(id string) error {
+	query := `DELETE FROM data_exports WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
@@ -0,0 +1,268 @@
+package account
+
+import (
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/password"
+	"fit-byte/usecases/audit"
+	"fit-byte/usecases/file"
+	"fit-byte/usecases/session"
+	"fit-byte/usecases/user"
+	"fit-byte/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// exportStaleAfter is how long an export may run before it is assumed its
+// instance died, and it is started over.
+const exportStaleAfter = time.Hour
+
+type AccountService struct {
+	accountRepository AccountRepository
+	userRepository    user.UserRepository
+	auditRepository   audit.AuditRepository
+	fileService       file.FileService
+	sessionService    session.SessionService
+	passwordHasher    *password.Hasher
+}
+
+func NewAccountService(accountRepository AccountRepository, userRepository user.UserRepository, auditRepository audit.AuditRepository, fileService file.FileService, sessionService session.SessionService, passwordHasher *password.Hasher) AccountService {
+	return AccountService{accountRepository, userRepository, auditRepository, fileService, sessionService, passwordHasher}
+}
+
+// RequestDeletion schedules the account for deletion once the grace period is
+// over and logs the user out everywhere. Logging back in, they can still
+// cancel it until then.
+func (s *AccountService) RequestDeletion(userId string, password string) (time.Time, error) {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if match, _ := s.passwordHasher.Verify(user.Password, password); !match {
+		return time.Time{}, models.NewError(http.StatusUnauthorized, "Invalid password")
+	}
+	if user.DeletionScheduledAt.Valid {
+		return user.DeletionScheduledAt.Time, nil
+	}
+
+	deletionAt := time.Now().Add(constants.ACCOUNT_DELETION_GRACE_PERIOD)
+	if err := s.accountRepository.ScheduleDeletion(userId, deletionAt); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.sessionService.RevokeOtherSessions(userId, ""); err != nil {
+		return time.Time{}, err
+	}
+
+	return deletionAt, nil
+}
+
+func (s *AccountService) CancelDeletion(userId string) error {
+	return s.accountRepository.CancelDeletion(userId)
+}
+
+// PurgeDeletedAccounts deletes the accounts whose grace period is over, then
+// their files in the storage backend.
+func (s *AccountService) PurgeDeletedAccounts() error {
+	users, err := s.accountRepository.FindDueForDeletion()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := s.purgeAccount(&user); err != nil {
+			log.Printf("Error purging account %s: %v", user.Id, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *AccountService) purgeAccount(user *models.User) error {
+	files, err := s.fileService.FindUserFiles(user.Id)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(files)+1)
+	for _, file := range files {
+		keys = append(keys, file.Key)
+	}
+	// images uploaded before files were tracked are only known by their uri
+	imageUriPrefix := utils.GenerateS3FileURL("")
+	if user.ImageUri.Valid && strings.HasPrefix(user.ImageUri.String, imageUriPrefix) {
+		keys = append(keys, strings.TrimPrefix(user.ImageUri.String, imageUriPrefix))
+	}
+	exportKeys, err := s.accountRepository.FindExportFileKeys(user.Id)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, exportKeys...)
+
+	// the row goes first, deleting it is what checks the deletion wasn't
+	// cancelled since the account was picked
+	deleted, err := s.accountRepository.DeleteUser(user.Id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return nil
+	}
+
+	filesErr := s.fileService.DeleteObjects(keys)
+	err = s.auditRepository.Save(models.AuditLog{
+		Action:     "account.deleted",
+		TargetType: pgtype.Text{String: "user", Valid: true},
+		TargetId:   pgtype.Text{String: user.Id, Valid: true},
+		Metadata: map[string]any{
+			"deletionScheduledAt": user.DeletionScheduledAt.Time,
+			"deletedFiles":        len(keys),
+		},
+	})
+	if filesErr != nil {
+		return fmt.Errorf("the account is deleted but not its %d files: %v", len(keys), filesErr)
+	}
+
+	return err
+}
+
+// RequestExport queues an export of the user's data, processed by
+// ProcessExports.
+func (s *AccountService) RequestExport(userId string) (*models.DataExport, error) {
+	export, err := s.accountRepository.SaveExport(userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NewError(http.StatusConflict, "An export is already in progress")
+		}
+
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (s *AccountService) GetExports(userId string) ([]models.DataExport, error) {
+	return s.accountRepository.FindExports(userId)
+}
+
+// GetExport returns the export along with a short-lived link to download it,
+// once it is done.
+func (s *AccountService) GetExport(id string, userId string) (*models.DataExport, string, error) {
+	export, err := s.accountRepository.FindExport(id, userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", models.NewError(http.StatusNotFound, "")
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return nil, "", models.NewError(http.StatusNotFound, "")
+		}
+
+		return nil, "", err
+	}
+	if export.Status != "DONE" || !export.FileKey.Valid || export.ExpiresAt.Time.Before(time.Now()) {
+		return export, "", nil
+	}
+
+	downloadUrl, err := s.fileService.PresignGetObject(export.FileKey.String, constants.DATA_EXPORT_DOWNLOAD_URL_TTL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return export, downloadUrl, nil
+}
+
+// ProcessExports generates the queued exports one after the other.
+func (s *AccountService) ProcessExports() error {
+	for {
+		export, err := s.accountRepository.ClaimExport(exportStaleAfter)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := s.generateExport(export); err != nil {
+			log.Printf("Error generating export %s: %v", export.Id, err)
+			if err := s.accountRepository.FailExport(export.Id, "The export couldn't be generated"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *AccountService) generateExport(export *models.DataExport) error {
+	data := exportData{
+		openFile: s.fileService.GetObject,
+		forEachTrackPoint: func(fn func(models.TrackPoint) error) error {
+			return s.accountRepository.ForEachTrackPoint(export.UserId, fn)
+		},
+	}
+	var err error
+	if data.user, err = s.userRepository.FindById(export.UserId); err != nil {
+		return err
+	}
+	if data.activities, err = s.accountRepository.FindActivities(export.UserId); err != nil {
+		return err
+	}
+	if data.measurements, err = s.accountRepository.FindMeasurements(export.UserId); err != nil {
+		return err
+	}
+	if data.goals, err = s.accountRepository.FindGoals(export.UserId); err != nil {
+		return err
+	}
+	if data.files, err = s.fileService.FindUserFiles(export.UserId); err != nil {
+		return err
+	}
+
+	// the archive can hold every uploaded file, so it is spooled to disk
+	archive, err := os.CreateTemp("", "fit-byte-export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := writeArchive(archive, data); err != nil {
+		return err
+	}
+	if _, err := archive.Seek(0, 0); err != nil {
+		return err
+	}
+
+	fileKey := fmt.Sprintf("exports/%s/%s.zip", export.UserId, export.Id)
+	if err := s.fileService.PutPrivateObject(fileKey, archive, "application/zip"); err != nil {
+		return err
+	}
+
+	return s.accountRepository.CompleteExport(export.Id, fileKey, time.Now().Add(constants.DATA_EXPORT_TTL))
+}
+
+// PurgeExpiredExports removes the archives nobody can download anymore.
+func (s *AccountService) PurgeExpiredExports() error {
+	exports, err := s.accountRepository.FindExpiredExports()
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.FileKey.Valid {
+			if err := s.fileService.DeleteObjects([]string{export.FileKey.String}); err != nil {
+				return err
+			}
+		}
+		if err := s.accountRepository.DeleteExport(export.Id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package account
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fit-byte/models"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// exportData is everything a user stored, written to their export archive.
+// Weights are in kilograms and lengths in centimeters, times in UTC.
+type exportData struct {
+	user         *models.User
+	activities   []models.Activity
+	measurements []models.BodyMeasurement
+	goals        []models.Goal
+	files        []models.UploadedFile
+	// openFile reads the content of an uploaded file
+	openFile func(key string) (io.ReadCloser, error)
+	// forEachTrackPoint calls fn with the track points of the activities
+	forEachTrackPoint func(fn func(models.TrackPoint) error) error
+}
+
+type exportProfile struct {
+	Email         string        `json:"email"`
+	Name          pgtype.Text   `json:"name"`
+	Preference    pgtype.Text   `json:"preference"`
+	WeightKg      pgtype.Float8 `json:"weightKg"`
+	HeightCm      pgtype.Float8 `json:"heightCm"`
+	WeightUnit    pgtype.Text   `json:"weightUnit"`
+	HeightUnit    pgtype.Text   `json:"heightUnit"`
+	ImageUri      pgtype.Text   `json:"imageUri"`
+	Timezone      string        `json:"timezone"`
+	Role          string        `json:"role"`
+	EmailVerified bool          `json:"emailVerified"`
+}
+
+type exportActivity struct {
+	ActivityId            string        `json:"activityId"`
+	ActivityType          string        `json:"activityType"`
+	DoneAt                time.Time     `json:"doneAt"`
+	DurationInMinutes     int           `json:"durationInMinutes"`
+	CaloriesBurned        int           `json:"caloriesBurned"`
+	DistanceInMeters      pgtype.Float8 `json:"distanceInMeters"`
+	ElevationGainInMeters pgtype.Float8 `json:"elevationGainInMeters"`
+	AverageHeartRate      pgtype.Int4   `json:"averageHeartRate"`
+	CreatedAt             time.Time     `json:"createdAt"`
+	UpdatedAt             time.Time     `json:"updatedAt"`
+}
+
+type exportMeasurement struct {
+	MeasurementId     string        `json:"measurementId"`
+	MeasuredAt        time.Time     `json:"measuredAt"`
+	WeightKg          pgtype.Float8 `json:"weightKg"`
+	BodyFatPercentage pgtype.Float8 `json:"bodyFatPercentage"`
+	WaistCm           pgtype.Float8 `json:"waistCm"`
+	RestingHeartRate  pgtype.Int4   `json:"restingHeartRate"`
+	CreatedAt         time.Time     `json:"createdAt"`
+}
+
+// writeArchive writes the export as a ZIP of JSON files, CSV copies of the
+// tabular ones, the track points of the activities as CSV, and the uploaded
+// files under files/.
+func writeArchive(w io.Writer, data exportData) error {
+	archive := zip.NewWriter(w)
+
+	user := data.user
+	profile := exportProfile{
+		Email:         user.Email,
+		Name:          user.Name,
+		Preference:    user.Preference,
+		WeightKg:      user.Weight,
+		HeightCm:      user.Height,
+		WeightUnit:    user.WeightUnit,
+		HeightUnit:    user.HeightUnit,
+		ImageUri:      user.ImageUri,
+		Timezone:      user.Timezone,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+	if err := writeJSON(archive, "profile.json", profile); err != nil {
+		return err
+	}
+
+	activities := make([]exportActivity, 0, len(data.activities))
+	activityRows := [][]string{{"activityId", "activityType", "doneAt", "durationInMinutes", "caloriesBurned", "distanceInMeters", "elevationGainInMeters", "averageHeartRate", "createdAt", "updatedAt"}}
+	for _, activity := range data.activities {
+		activities = append(activities, exportActivity{
+			ActivityId:            activity.Id,
+			ActivityType:          activity.ActivityType,
+			DoneAt:                activity.DoneAt,
+			DurationInMinutes:     activity.DurationInMinutes,
+			CaloriesBurned:        activity.CaloriesBurned,
+			DistanceInMeters:      activity.DistanceInMeters,
+			ElevationGainInMeters: activity.ElevationGainInMeters,
+			AverageHeartRate:      activity.AverageHeartRate,
+			CreatedAt:             activity.CreatedAt,
+			UpdatedAt:             activity.UpdatedAt,
+		})
+		activityRows = append(activityRows, []string{
+			activity.Id,
+			activity.ActivityType,
+			formatTime(activity.DoneAt),
+			strconv.Itoa(activity.DurationInMinutes),
+			strconv.Itoa(activity.CaloriesBurned),
+			formatFloat(activity.DistanceInMeters),
+			formatFloat(activity.ElevationGainInMeters),
+			formatInt(activity.AverageHeartRate),
+			formatTime(activity.CreatedAt),
+			formatTime(activity.UpdatedAt),
+		})
+	}
+	if err := writeJSON(archive, "activities.json", activities); err != nil {
+		return err
+	}
+	if err := writeCSV(archive, "activities.csv", activityRows); err != nil {
+		return err
+	}
+	if err := writeTrackPoints(archive, "track_points.csv", data.forEachTrackPoint); err != nil {
+		return err
+	}
+
+	measurements := make([]exportMeasurement, 0, len(data.measurements))
+	measurementRows := [][]string{{"measurementId", "measuredAt", "weightKg", "bodyFatPercentage", "waistCm", "restingHeartRate", "createdAt"}}
+	for _, measurement := range data.measurements {
+		measurements = append(measurements, exportMeasurement{
+			MeasurementId:     measurement.Id,
+			MeasuredAt:        measurement.MeasuredAt,
+			WeightKg:          measurement.Weight,
+			BodyFatPercentage: measurement.BodyFatPercentage,
+			WaistCm:           measurement.Waist,
+			RestingHeartRate:  measurement.RestingHeartRate,
+			CreatedAt:         measurement.CreatedAt,
+		})
+		measurementRows = append(measurementRows, []string{
+			measurement.Id,
+			formatTime(measurement.MeasuredAt),
+			formatFloat(measurement.Weight),
+			formatFloat(measurement.BodyFatPercentage),
+			formatFloat(measurement.Waist),
+			formatInt(measurement.RestingHeartRate),
+			formatTime(measurement.CreatedAt),
+		})
+	}
+	if err := writeJSON(archive, "measurements.json", measurements); err != nil {
+		return err
+	}
+	if err := writeCSV(archive, "measurements.csv", measurementRows); err != nil {
+		return err
+	}
+
+	if err := writeJSON(archive, "goals.json", data.goals); err != nil {
+		return err
+	}
+
+	if err := writeJSON(archive, "files.json", data.files); err != nil {
+		return err
+	}
+	for _, file := range data.files {
+		if err := copyFile(archive, "files/"+file.Key, file.Key, data.openFile); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeJSON(archive *zip.Writer, name string, value any) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func writeCSV(archive *zip.Writer, name string, rows [][]string) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+// writeTrackPoints writes the track points as they are read, there can be
+// too many to hold them all.
+func writeTrackPoints(archive *zip.Writer, name string, forEachTrackPoint func(fn func(models.TrackPoint) error) error) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"activityId", "recordedAt", "latitude", "longitude", "elevation", "heartRate", "power"}); err != nil {
+		return err
+	}
+	err = forEachTrackPoint(func(point models.TrackPoint) error {
+		return writer.Write([]string{
+			point.ActivityId,
+			formatTime(point.RecordedAt),
+			formatFloat(point.Latitude),
+			formatFloat(point.Longitude),
+			formatFloat(point.Elevation),
+			formatInt(point.HeartRate),
+			formatInt(point.Power),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func copyFile(archive *zip.Writer, name string, key string, openFile func(key string) (io.ReadCloser, error)) error {
+	file, err := openFile(key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+
+	return err
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatFloat(value pgtype.Float8) string {
+	if !value.Valid {
+		return ""
+	}
+
+	return strconv.FormatFloat(value.Float64, 'f', -1, 64)
+}
+
+func formatInt(value pgtype.Int4) string {
+	if !value.Valid {
+		return ""
+	}
+
+	return strconv.Itoa(int(value.Int32))
+}
@@ -1,17 +1,24 @@
 package activity
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fit-byte/constants"
 	"fit-byte/models"
 	"fit-byte/types"
 	"fit-byte/utils"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"time"
 
+	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type AcitivityHandler struct {
@@ -22,50 +29,124 @@ func NewActivityHandler(activityService ActivityService) AcitivityHandler {
 	return AcitivityHandler{activityService}
 }
 
-func (h *AcitivityHandler) HandleCreateActivity(w http.ResponseWriter, r *http.Request) error {
-	payload := struct {
-		ActivityType      string    `json:"activityType" validate:"required,oneof=Walking Yoga Stretching Cycling Swimming Dancing Hiking Running HIIT JumpRope"`
-		DoneAt            time.Time `json:"doneAt" validate:"required"`
-		DurationInMinutes int       `json:"durationInMinutes" validate:"required,min=1"`
-	}{}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		return models.NewError(http.StatusBadRequest, err.Error())
+type ActivityResponse struct {
+	ActivityId        string           `json:"activityId"`
+	ActivityType      string           `json:"activityType"`
+	DoneAt            types.CustomTime `json:"doneAt"`
+	DurationInMinutes int              `json:"durationInMinutes"`
+	CaloriesBurned    int              `json:"caloriesBurned"`
+	CreatedAt         types.CustomTime `json:"createdAt"`
+	UpdatedAt         types.CustomTime `json:"updatedAt"`
+	// recorded by devices, null for activities entered by hand
+	DistanceInMeters      pgtype.Float8 `json:"distanceInMeters"`
+	ElevationGainInMeters pgtype.Float8 `json:"elevationGainInMeters"`
+	AverageHeartRate      pgtype.Int4   `json:"averageHeartRate"`
+}
+
+// NewActivityResponse is how activities are rendered, to the owner as well
+// as to admins.
+func NewActivityResponse(activity models.Activity) ActivityResponse {
+	return ActivityResponse{
+		ActivityId:            activity.Id,
+		ActivityType:          activity.ActivityType,
+		DoneAt:                types.CustomTime(activity.DoneAt),
+		DurationInMinutes:     activity.DurationInMinutes,
+		CaloriesBurned:        activity.CaloriesBurned,
+		CreatedAt:             types.CustomTime(activity.CreatedAt),
+		UpdatedAt:             types.CustomTime(activity.UpdatedAt),
+		DistanceInMeters:      activity.DistanceInMeters,
+		ElevationGainInMeters: activity.ElevationGainInMeters,
+		AverageHeartRate:      activity.AverageHeartRate,
+	}
+}
+
+type TrashedActivityResponse struct {
+	ActivityResponse
+	DeletedAt types.CustomTime `json:"deletedAt"`
+	PurgeAt   types.CustomTime `json:"purgeAt"`
+}
+
+type createActivityPayload struct {
+	ActivityType      string    `json:"activityType" validate:"required,oneof=Walking Yoga Stretching Cycling Swimming Dancing Hiking Running HIIT JumpRope"`
+	DoneAt            time.Time `json:"doneAt" validate:"required"`
+	DurationInMinutes int       `json:"durationInMinutes" validate:"required,min=1"`
+}
+
+// decodeCreateActivity reads an activity to create, the same way whether it
+// comes alone or in a batch.
+func decodeCreateActivity(data []byte, userId string) (models.Activity, error) {
+	payload := createActivityPayload{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return models.Activity{}, models.NewError(http.StatusBadRequest, err.Error())
 	}
 	validate := validator.New(validator.WithRequiredStructEnabled())
 	if err := validate.Struct(payload); err != nil {
 		for _, err := range err.(validator.ValidationErrors) {
 			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
-			return models.NewError(http.StatusBadRequest, validationErr.Error())
+			return models.Activity{}, models.NewError(http.StatusBadRequest, validationErr.Error())
 		}
 	}
 
-	newActivity, err := h.activityService.CreateActivity(models.Activity{
+	return models.Activity{
 		ActivityType:      payload.ActivityType,
 		DoneAt:            payload.DoneAt,
 		DurationInMinutes: payload.DurationInMinutes,
-	})
+		UserId:            pgtype.Text{String: userId, Valid: true},
+	}, nil
+}
+
+// decodeUpdateActivity checks the fields of an update, the same way whether
+// it comes alone or in a batch.
+func decodeUpdateActivity(payload *types.UpdateActivityPayload) error {
+	if string(payload.ActivityTypeRaw) == "null" || string(payload.DoneAtRaw) == "null" {
+		return models.NewError(http.StatusBadRequest, "input can't be null")
+	}
+	if payload.ActivityTypeRaw != nil {
+		if err := json.Unmarshal([]byte(payload.ActivityTypeRaw), &payload.ActivityType); err != nil {
+			return models.NewError(http.StatusBadRequest, err.Error())
+		}
+	}
+	if payload.DoneAtRaw != nil {
+		if err := json.Unmarshal([]byte(payload.DoneAtRaw), &payload.DoneAt); err != nil {
+			return models.NewError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	return nil
+}
+
+func (h *AcitivityHandler) HandleCreateActivity(w http.ResponseWriter, r *http.Request) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	activity, err := decodeCreateActivity(data, userId)
 	if err != nil {
 		return err
 	}
 
-	res := struct {
-		ActivityId        string    `json:"activityId"`
-		ActivityType      string    `json:"activityType"`
-		DoneAt            CustomTime `json:"doneAt"`
-		DurationInMinutes int       `json:"durationInMinutes"`
-		CaloriesBurned    int       `json:"caloriesBurned"`
-		CreatedAt         CustomTime `json:"createdAt"`
-		UpdatedAt         CustomTime `json:"updatedAt"`
-	}{
-		ActivityId:        newActivity.Id,
-		ActivityType:      newActivity.ActivityType,
-		DoneAt:            CustomTime(newActivity.DoneAt),
-		DurationInMinutes: newActivity.DurationInMinutes,
-		CaloriesBurned:    newActivity.CaloriesBurned,
-		CreatedAt:         CustomTime(newActivity.CreatedAt),
-		UpdatedAt:         CustomTime(newActivity.UpdatedAt),
+	newActivity, err := h.activityService.CreateActivity(activity)
+	if err != nil {
+		return err
 	}
-	utils.SetJsonResponse(w, http.StatusCreated, res)
+
+	w.Header().Set("ETag", utils.ETag(newActivity.Version, ""))
+	utils.SetJsonResponse(w, http.StatusCreated, NewActivityResponse(*newActivity))
 
 	return nil
 }
@@ -76,27 +157,60 @@ func IsISO8601Date(fl validator.FieldLevel) bool {
 	return ISO8601DateRegex.MatchString(fl.Field().String())
 }
 
-func (h *AcitivityHandler) HandleGetAllActivities(w http.ResponseWriter, r *http.Request) error {
-
+// parseActivityFilter reads the filters of the activity list, invalid ones
+// are ignored.
+func parseActivityFilter(params url.Values) ActivityFilter {
 	validate := validator.New()
 	validate.RegisterValidation("ISO8601date", IsISO8601Date)
 
-	params := r.URL.Query()
-	limitStr := params.Get("limit")
-	offsetStr := params.Get("offset")
 	activityTypeRaw := params.Get("activityType")
 	doneAtFromRaw := params.Get("doneAtFrom")
 	doneAtToRaw := params.Get("doneAtTo")
 	caloriesBurnedMinRaw := params.Get("caloriesBurnedMin")
 	caloriesBurnedMaxRaw := params.Get("caloriesBurnedMax")
-	limit := 5
-	offset := 0
 	var activityType *string = &activityTypeRaw
 	var doneAtFrom *string = &doneAtFromRaw
 	var doneAtTo *string = &doneAtToRaw
 	var caloriesBurnedMin *string = &caloriesBurnedMinRaw
 	var caloriesBurnedMax *string = &caloriesBurnedMaxRaw
 
+	if err := validate.Var(activityType, "oneof=Walking Yoga Stretching Cycling Swimming Dancing Hiking Running HIIT JumpRope"); err != nil {
+		// fmt.Println("----- SKIP activityType VALIDATION")
+		activityType = nil
+	}
+	if err := validate.Var(doneAtFrom, "ISO8601date"); err != nil {
+		// fmt.Println("----- SKIP doneAtFrom VALIDATION")
+		doneAtFrom = nil
+	}
+	if err := validate.Var(doneAtTo, "ISO8601date"); err != nil {
+		// fmt.Println("----- SKIP doneAtTo VALIDATION")
+		doneAtTo = nil
+	}
+	if err := validate.Var(caloriesBurnedMin, "numeric"); err != nil {
+		// fmt.Println("----- SKIP caloriesBurnedMin VALIDATION")
+		caloriesBurnedMin = nil
+	}
+	if err := validate.Var(caloriesBurnedMax, "numeric"); err != nil {
+		// fmt.Println("----- SKIP caloriesBurnedMax VALIDATION")
+		caloriesBurnedMax = nil
+	}
+
+	return ActivityFilter{
+		ActivityType:      activityType,
+		DoneAtFrom:        doneAtFrom,
+		DoneAtTo:          doneAtTo,
+		CaloriesBurnedMin: caloriesBurnedMin,
+		CaloriesBurnedMax: caloriesBurnedMax,
+	}
+}
+
+func (h *AcitivityHandler) HandleGetAllActivities(w http.ResponseWriter, r *http.Request) error {
+	params := r.URL.Query()
+	limitStr := params.Get("limit")
+	offsetStr := params.Get("offset")
+	limit := 5
+	offset := 0
+
 	if limitStr != "" {
 		limitTemp, err := strconv.Atoi(limitStr)
 		if err != nil {
@@ -115,104 +229,290 @@ func (h *AcitivityHandler) HandleGetAllActivities(w http.ResponseWriter, r *http
 			offset = offsetTemp
 		}
 	}
-	if err := validate.Var(activityType, "oneof=Walking Yoga Stretching Cycling Swimming Dancing Hiking Running HIIT JumpRope"); err != nil {
-		// fmt.Println("----- SKIP activityType VALIDATION")
-		activityType = nil
+	filter := parseActivityFilter(params)
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
 	}
-	if err := validate.Var(doneAtFrom, "ISO8601date"); err != nil {
-		// fmt.Println("----- SKIP doneAtFrom VALIDATION")
-		doneAtFrom = nil
+	userId := claims["userId"].(string)
+
+	activities, err := h.activityService.GetAllActivities(userId, offset, limit, filter)
+	if err != nil {
+		return err
 	}
-	if err := validate.Var(doneAtTo, "ISO8601date"); err != nil {
-		// fmt.Println("----- SKIP doneAtTo VALIDATION")
-		doneAtTo = nil
+
+	res := make([]ActivityResponse, 0, len(activities))
+	for _, activity := range activities {
+		res = append(res, NewActivityResponse(activity))
 	}
-	if err := validate.Var(caloriesBurnedMin, "numeric"); err != nil {
-		// fmt.Println("----- SKIP caloriesBurnedMin VALIDATION")
-		caloriesBurnedMin = nil
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+// activityCSVHeader is the header of exported activities, the CSV import
+// reads the same columns by default.
+var activityCSVHeader = []string{"activityId", "activityType", "doneAt", "durationInMinutes", "caloriesBurned", "distanceInMeters", "elevationGainInMeters", "averageHeartRate", "createdAt", "updatedAt"}
+
+// HandleExportActivities streams every activity matching the filters of the
+// activity list, regardless of limit and offset.
+func (h *AcitivityHandler) HandleExportActivities(w http.ResponseWriter, r *http.Request) error {
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = "csv"
 	}
-	if err := validate.Var(caloriesBurnedMax, "numeric"); err != nil {
-		// fmt.Println("----- SKIP caloriesBurnedMax VALIDATION")
-		caloriesBurnedMax = nil
+	if format != "csv" {
+		return models.NewError(http.StatusBadRequest, "Only the csv format is supported")
 	}
+	filter := parseActivityFilter(params)
 
-	activities, err := h.activityService.GetAllActivities(offset, limit, activityType, doneAtFrom, doneAtTo, caloriesBurnedMin, caloriesBurnedMax)
+	_, claims, err := jwtauth.FromContext(r.Context())
 	if err != nil {
-		return err
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	writer := csv.NewWriter(w)
+	written := 0
+	// the header is sent along the first row, an error before it is still
+	// answered with its status
+	start := func() {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="activities.csv"`)
+		writer.Write(activityCSVHeader)
 	}
+	err = h.activityService.ExportActivities(userId, filter, func(activity models.Activity) error {
+		if written == 0 {
+			start()
+		}
+		written++
 
-	utils.SetJsonResponse(w, http.StatusOK, activities)
+		writer.Write([]string{
+			activity.Id,
+			activity.ActivityType,
+			formatCSVTime(activity.DoneAt),
+			strconv.Itoa(activity.DurationInMinutes),
+			strconv.Itoa(activity.CaloriesBurned),
+			formatCSVFloat(activity.DistanceInMeters),
+			formatCSVFloat(activity.ElevationGainInMeters),
+			formatCSVInt(activity.AverageHeartRate),
+			formatCSVTime(activity.CreatedAt),
+			formatCSVTime(activity.UpdatedAt),
+		})
+		// send the rows as they come rather than buffering the export
+		if written%constants.ACTIVITY_EXPORT_FLUSH_EVERY == 0 {
+			writer.Flush()
+			http.NewResponseController(w).Flush()
+		}
 
-	return nil
+		return writer.Error()
+	})
+	if err != nil {
+		if written == 0 {
+			return err
+		}
+		// the status is sent already, cut the response short so that the
+		// client doesn't take it for the whole export
+		log.Printf("Error exporting activities of %s: %v", userId, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if written == 0 {
+		start()
+	}
+	writer.Flush()
+
+	return writer.Error()
 }
 
-func (h *AcitivityHandler) HandleUpdateActivity(w http.ResponseWriter, r *http.Request) error {
-	activityId := r.PathValue("activityId")
-	payload := types.UpdateActivityPayload{}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		return models.NewError(http.StatusBadRequest, err.Error())
+func formatCSVTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func formatCSVFloat(value pgtype.Float8) string {
+	if !value.Valid {
+		return ""
 	}
+	return strconv.FormatFloat(value.Float64, 'f', -1, 64)
+}
 
-	if string(payload.ActivityTypeRaw) == "null" || string(payload.DoneAtRaw) == "null" {
-		return models.NewError(http.StatusBadRequest, "input can't be null")
+func formatCSVInt(value pgtype.Int4) string {
+	if !value.Valid {
+		return ""
 	}
-	if payload.ActivityTypeRaw != nil {
-		if err := json.Unmarshal([]byte(payload.ActivityTypeRaw), &payload.ActivityType); err != nil {
+	return strconv.Itoa(int(value.Int32))
+}
+
+func (h *AcitivityHandler) HandleGetTrash(w http.ResponseWriter, r *http.Request) error {
+	params := r.URL.Query()
+	limitStr := params.Get("limit")
+	offsetStr := params.Get("offset")
+	limit := 5
+	offset := 0
+
+	if limitStr != "" {
+		limitTemp, err := strconv.Atoi(limitStr)
+		if err != nil {
 			return models.NewError(http.StatusBadRequest, err.Error())
 		}
+		if limitTemp >= 0 {
+			limit = limitTemp
+		}
 	}
-	if payload.DoneAtRaw != nil {
-		if err := json.Unmarshal([]byte(payload.DoneAtRaw), &payload.DoneAt); err != nil {
+	if offsetStr != "" {
+		offsetTemp, err := strconv.Atoi(offsetStr)
+		if err != nil {
 			return models.NewError(http.StatusBadRequest, err.Error())
 		}
+		if offsetTemp >= 0 {
+			offset = offsetTemp
+		}
 	}
 
-	validate := validator.New(validator.WithRequiredStructEnabled())
-	if err := validate.Struct(payload); err != nil {
-		for _, err := range err.(validator.ValidationErrors) {
-			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
-			return models.NewError(http.StatusBadRequest, validationErr.Error())
-		}
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
 	}
+	userId := claims["userId"].(string)
 
-	activity, err := h.activityService.UpdateActivity(activityId, payload)
+	activities, err := h.activityService.GetTrash(userId, offset, limit)
 	if err != nil {
 		return err
 	}
 
-	res := struct {
-		ActivityId        string    `json:"activityId"`
-		ActivityType      string    `json:"activityType"`
-		DoneAt            CustomTime `json:"doneAt"`
-		DurationInMinutes int       `json:"durationInMinutes"`
-		CaloriesBurned    int       `json:"caloriesBurned"`
-		CreatedAt         CustomTime `json:"createdAt"`
-		UpdatedAt         CustomTime `json:"updatedAt"`
-	}{
-		ActivityId:        activity.Id,
-		ActivityType:      activity.ActivityType,
-		DoneAt:            CustomTime(activity.DoneAt),
-		DurationInMinutes: activity.DurationInMinutes,
-		CaloriesBurned:    activity.CaloriesBurned,
-		CreatedAt:         CustomTime(activity.CreatedAt),
-		UpdatedAt:         CustomTime(activity.UpdatedAt),
+	res := make([]TrashedActivityResponse, 0, len(activities))
+	for _, activity := range activities {
+		res = append(res, TrashedActivityResponse{
+			ActivityResponse: NewActivityResponse(activity),
+			DeletedAt:        types.CustomTime(activity.DeletedAt.Time),
+			PurgeAt:          types.CustomTime(h.activityService.PurgeAt(activity.DeletedAt.Time)),
+		})
 	}
 	utils.SetJsonResponse(w, http.StatusOK, res)
 
 	return nil
 }
 
-type CustomTime time.Time
+func (h *AcitivityHandler) HandleRestoreActivity(w http.ResponseWriter, r *http.Request) error {
+	activityId := r.PathValue("activityId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	activity, err := h.activityService.RestoreActivity(activityId, userId)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", utils.ETag(activity.Version, ""))
+	utils.SetJsonResponse(w, http.StatusOK, NewActivityResponse(*activity))
 
-func (ct CustomTime) MarshalJSON() ([]byte, error) {
-    t := time.Time(ct)
-    return []byte(`"` + t.Format("2006-01-02T15:04:05.000Z") + `"`), nil
+	return nil
+}
+
+func (h *AcitivityHandler) HandleGetActivity(w http.ResponseWriter, r *http.Request) error {
+	activityId := r.PathValue("activityId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	activity, err := h.activityService.GetActivity(activityId, userId)
+	if err != nil {
+		return err
+	}
+
+	if utils.NotModified(w, r, utils.ETag(activity.Version, "")) {
+		return nil
+	}
+	utils.SetJsonResponse(w, http.StatusOK, NewActivityResponse(*activity))
+
+	return nil
+}
+
+func (h *AcitivityHandler) HandleGetActivityHistory(w http.ResponseWriter, r *http.Request) error {
+	activityId := r.PathValue("activityId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	revisions, err := h.activityService.GetActivityHistory(activityId, userId)
+	if err != nil {
+		return err
+	}
+	utils.SetJsonResponse(w, http.StatusOK, revisions)
+
+	return nil
+}
+
+func (h *AcitivityHandler) HandleGetActivityTrack(w http.ResponseWriter, r *http.Request) error {
+	activityId := r.PathValue("activityId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	points, err := h.activityService.GetActivityTrack(activityId, userId)
+	if err != nil {
+		return err
+	}
+	utils.SetJsonResponse(w, http.StatusOK, points)
+
+	return nil
+}
+
+func (h *AcitivityHandler) HandleUpdateActivity(w http.ResponseWriter, r *http.Request) error {
+	activityId := r.PathValue("activityId")
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
+	payload := types.UpdateActivityPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err := decodeUpdateActivity(&payload); err != nil {
+		return err
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	activity, err := h.activityService.UpdateActivity(activityId, userId, version, payload)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", utils.ETag(activity.Version, ""))
+	utils.SetJsonResponse(w, http.StatusOK, NewActivityResponse(*activity))
+
+	return nil
 }
 
 func (h *AcitivityHandler) HandleDeleteActivity(w http.ResponseWriter, r *http.Request) error {
 	activityId := r.PathValue("activityId")
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
 
-	err := h.activityService.DeleteActivity(activityId)
+	err = h.activityService.DeleteActivity(activityId, userId, version)
 	if err != nil {
 		return err
 	}
@@ -221,3 +521,216 @@ func (h *AcitivityHandler) HandleDeleteActivity(w http.ResponseWriter, r *http.R
 
 	return nil
 }
+
+// BatchItemResponse is the outcome of one item of a batch sent in partial
+// mode, status being the one the item would get on its own.
+type BatchItemResponse struct {
+	Index    int               `json:"index"`
+	Status   int               `json:"status"`
+	Activity *ActivityResponse `json:"activity,omitempty"`
+	Message  string            `json:"message,omitempty"`
+}
+
+// NewBatchItemResponse tells the outcome of the item at index, err taking
+// precedence over status.
+func NewBatchItemResponse(index int, status int, activity *models.Activity, err error) BatchItemResponse {
+	res := BatchItemResponse{Index: index, Status: status}
+	if activity != nil {
+		activityResponse := NewActivityResponse(*activity)
+		res.Activity = &activityResponse
+	}
+	if err != nil {
+		res.Status = http.StatusInternalServerError
+		if appErr, ok := err.(*models.AppError); ok && appErr.Code != 0 {
+			res.Status = appErr.Code
+		}
+		res.Message = err.Error()
+	}
+
+	return res
+}
+
+// validateBatch checks the mode, ATOMIC by default, and the number of items.
+func validateBatch(mode string, size int) error {
+	if mode != "" && mode != constants.BATCH_MODE_ATOMIC && mode != constants.BATCH_MODE_PARTIAL {
+		return models.NewError(http.StatusBadRequest, "validation for 'mode' failed")
+	}
+	if size == 0 || size > constants.ACTIVITY_BATCH_MAX_SIZE {
+		return models.NewError(http.StatusBadRequest, fmt.Sprintf("a batch must hold between 1 and %d items", constants.ACTIVITY_BATCH_MAX_SIZE))
+	}
+
+	return nil
+}
+
+// HandleCreateActivities creates a batch of activities. In ATOMIC mode none
+// is created unless all are valid, in PARTIAL mode the valid ones are and
+// every item gets its own result.
+func (h *AcitivityHandler) HandleCreateActivities(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Mode       string            `json:"mode"`
+		Activities []json.RawMessage `json:"activities"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err := validateBatch(payload.Mode, len(payload.Activities)); err != nil {
+		return err
+	}
+	partial := payload.Mode == constants.BATCH_MODE_PARTIAL
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	results := make([]BatchItemResponse, len(payload.Activities))
+	activities := make([]models.Activity, 0, len(payload.Activities))
+	indexes := make([]int, 0, len(payload.Activities))
+	for i, data := range payload.Activities {
+		activity, err := decodeCreateActivity(data, userId)
+		if err != nil {
+			if !partial {
+				return batchItemError(i, err)
+			}
+			results[i] = NewBatchItemResponse(i, 0, nil, err)
+			continue
+		}
+		activities = append(activities, activity)
+		indexes = append(indexes, i)
+	}
+
+	newActivities := []models.Activity{}
+	if len(activities) > 0 {
+		newActivities, err = h.activityService.CreateActivities(activities)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !partial {
+		res := make([]ActivityResponse, 0, len(newActivities))
+		for _, activity := range newActivities {
+			res = append(res, NewActivityResponse(activity))
+		}
+		utils.SetJsonResponse(w, http.StatusCreated, res)
+		return nil
+	}
+
+	for j, i := range indexes {
+		results[i] = NewBatchItemResponse(i, http.StatusCreated, &newActivities[j], nil)
+	}
+	utils.SetJsonResponse(w, http.StatusMultiStatus, results)
+
+	return nil
+}
+
+// HandleUpdateActivities applies a batch of updates, each naming the activity
+// it applies to. Modes work as in HandleCreateActivities.
+func (h *AcitivityHandler) HandleUpdateActivities(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Mode       string            `json:"mode"`
+		Activities []json.RawMessage `json:"activities"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err := validateBatch(payload.Mode, len(payload.Activities)); err != nil {
+		return err
+	}
+	partial := payload.Mode == constants.BATCH_MODE_PARTIAL
+
+	results := make([]BatchItemResponse, len(payload.Activities))
+	updates := make([]types.BatchUpdateActivityPayload, 0, len(payload.Activities))
+	indexes := make([]int, 0, len(payload.Activities))
+	for i, data := range payload.Activities {
+		update := types.BatchUpdateActivityPayload{}
+		err := json.Unmarshal(data, &update)
+		if err != nil {
+			err = models.NewError(http.StatusBadRequest, err.Error())
+		} else if update.ActivityId == "" {
+			err = models.NewError(http.StatusBadRequest, "validation for 'ActivityId' failed")
+		} else {
+			err = decodeUpdateActivity(&update.UpdateActivityPayload)
+		}
+		if err != nil {
+			if !partial {
+				return batchItemError(i, err)
+			}
+			results[i] = NewBatchItemResponse(i, 0, nil, err)
+			continue
+		}
+		updates = append(updates, update)
+		indexes = append(indexes, i)
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	updated := []BatchResult{}
+	if len(updates) > 0 {
+		updated, err = h.activityService.UpdateActivities(userId, updates, partial)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !partial {
+		res := make([]ActivityResponse, 0, len(updated))
+		for _, result := range updated {
+			res = append(res, NewActivityResponse(*result.Activity))
+		}
+		utils.SetJsonResponse(w, http.StatusOK, res)
+		return nil
+	}
+
+	for j, i := range indexes {
+		results[i] = NewBatchItemResponse(i, http.StatusOK, updated[j].Activity, updated[j].Err)
+	}
+	utils.SetJsonResponse(w, http.StatusMultiStatus, results)
+
+	return nil
+}
+
+// HandleDeleteActivities moves a batch of activities to the trash. Modes work
+// as in HandleCreateActivities.
+func (h *AcitivityHandler) HandleDeleteActivities(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Mode        string   `json:"mode"`
+		ActivityIds []string `json:"activityIds"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	if err := validateBatch(payload.Mode, len(payload.ActivityIds)); err != nil {
+		return err
+	}
+	partial := payload.Mode == constants.BATCH_MODE_PARTIAL
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	deleted, err := h.activityService.DeleteActivities(userId, payload.ActivityIds, partial)
+	if err != nil {
+		return err
+	}
+
+	if !partial {
+		w.Write([]byte(""))
+		return nil
+	}
+
+	results := make([]BatchItemResponse, 0, len(deleted))
+	for i, result := range deleted {
+		results = append(results, NewBatchItemResponse(i, http.StatusOK, nil, result.Err))
+	}
+	utils.SetJsonResponse(w, http.StatusMultiStatus, results)
+
+	return nil
+}
@@ -2,14 +2,17 @@ package activity
 
 import (
 	"context"
+	"errors"
+	"fit-byte/constants"
 	"fit-byte/models"
 	"fit-byte/types"
 	"fit-byte/utils"
 	"fmt"
-	"net/http"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -22,71 +25,303 @@ func NewActivityRepository(ctx context.Context, pgConn *pgxpool.Pool) ActivityRe
 	return ActivityRepository{ctx, pgConn}
 }
 
-func (r *ActivityRepository) Save(activity models.Activity) (*models.Activity, error) {
-	query := `
+// beginner is the pool, or a transaction to nest a savepoint in.
+type beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// errBatchAborted rolls back a batch when one of its items failed.
+var errBatchAborted = errors.New("batch aborted")
+
+const insertActivityQuery = `
 	INSERT INTO activities (
 		activity_type, 
 		done_at, 
 		duration_in_minutes,
-		calories_burned
+		calories_burned,
+		user_id,
+		distance_in_meters,
+		elevation_gain_in_meters,
+		average_heart_rate
 	) 
 	VALUES (
 		@activity_type, 
 		@done_at, 
 		@duration_in_minutes,
-		@calories_burned
+		@calories_burned,
+		@user_id,
+		@distance_in_meters,
+		@elevation_gain_in_meters,
+		@average_heart_rate
 	)
 	RETURNING *
 	`
+
+// insertActivityArgs reckons the calories burned unless a device reported
+// them.
+func insertActivityArgs(activity models.Activity) pgx.NamedArgs {
+	caloriesBurned := activity.CaloriesBurned
+	if caloriesBurned == 0 {
+		caloriesBurned = utils.CalculateCaloriesBurned(activity.ActivityType, activity.DurationInMinutes)
+	}
+
+	return pgx.NamedArgs{
+		"activity_type":            activity.ActivityType,
+		"done_at":                  activity.DoneAt,
+		"duration_in_minutes":      activity.DurationInMinutes,
+		"calories_burned":          caloriesBurned,
+		"user_id":                  activity.UserId,
+		"distance_in_meters":       activity.DistanceInMeters,
+		"elevation_gain_in_meters": activity.ElevationGainInMeters,
+		"average_heart_rate":       activity.AverageHeartRate,
+	}
+}
+
+// Save creates the activity along with its first revision.
+func (r *ActivityRepository) Save(activity models.Activity) (*models.Activity, error) {
+	newActivities, err := r.SaveRecorded([]RecordedActivity{{Activity: activity}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &newActivities[0], nil
+}
+
+// SaveRecorded creates the activities in one transaction, each along with
+// its first revision and its track.
+func (r *ActivityRepository) SaveRecorded(recorded []RecordedActivity) ([]models.Activity, error) {
+	newActivities := make([]models.Activity, 0, len(recorded))
+	err := pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		for _, item := range recorded {
+			rows, _ := tx.Query(r.ctx, insertActivityQuery, insertActivityArgs(item.Activity))
+			newActivity, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+			if err != nil {
+				return err
+			}
+
+			if err := insertTrackPoints(r.ctx, tx, newActivity.Id, item.Track); err != nil {
+				return err
+			}
+			if err := r.saveRevision(tx, constants.ACTIVITY_REVISION_CREATE, item.Activity.UserId.String, nil, &newActivity); err != nil {
+				return err
+			}
+			newActivities = append(newActivities, newActivity)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newActivities, nil
+}
+
+func insertTrackPoints(ctx context.Context, tx pgx.Tx, activityId string, points []models.TrackPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	rows := make([][]any, 0, len(points))
+	for _, point := range points {
+		rows = append(rows, []any{activityId, point.RecordedAt, point.Latitude, point.Longitude, point.Elevation, point.HeartRate, point.Power})
+	}
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"activity_track_points"}, []string{"activity_id", "recorded_at", "latitude", "longitude", "elevation", "heart_rate", "power"}, pgx.CopyFromRows(rows))
+
+	return err
+}
+
+func (r *ActivityRepository) FindTrackPoints(activityId string) ([]models.TrackPoint, error) {
+	query := `SELECT * FROM activity_track_points WHERE activity_id = @activity_id ORDER BY recorded_at`
+	args := pgx.NamedArgs{
+		"activity_id": activityId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.TrackPoint])
+}
+
+// FindOverlapping returns an activity of the user's taking place, at least in
+// part, between startedAt and endedAt. Activities are taken to start at
+// done_at.
+func (r *ActivityRepository) FindOverlapping(userId string, startedAt time.Time, endedAt time.Time) (*models.Activity, error) {
+	query := `
+	SELECT * FROM activities
+	WHERE user_id = @user_id
+		AND deleted_at IS NULL
+		AND done_at < @ended_at
+		AND done_at + duration_in_minutes * INTERVAL '1 minute' > @started_at
+	ORDER BY done_at
+	LIMIT 1
+	`
 	args := pgx.NamedArgs{
-		"activity_type":       activity.ActivityType,
-		"done_at":             activity.DoneAt,
-		"duration_in_minutes": activity.DurationInMinutes,
-		"calories_burned": utils.CalculateCaloriesBurned(activity.ActivityType, activity.DurationInMinutes),
+		"user_id":    userId,
+		"started_at": startedAt,
+		"ended_at":   endedAt,
 	}
 
 	rows, _ := r.pgConn.Query(r.ctx, query, args)
-	newActivity, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+	activity, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
 	if err != nil {
 		return nil, err
 	}
 
-	return &newActivity, nil
+	return &activity, nil
 }
 
-func (r *ActivityRepository) GetAllActivities(offset int, limit int, activityType *string, doneAtFrom *string, doneAtTo *string, caloriesBurnedMin *string, caloriesBurnedMax *string) ([]models.Activity, error) {
-	var conditions []string
+// SaveMany creates all the activities, along with their first revisions, in
+// one transaction. The inserts are sent to the database in a single batch.
+func (r *ActivityRepository) SaveMany(activities []models.Activity) ([]models.Activity, error) {
+	batch := &pgx.Batch{}
+	for _, activity := range activities {
+		batch.Queue(insertActivityQuery, insertActivityArgs(activity))
+	}
+
+	newActivities := make([]models.Activity, 0, len(activities))
+	err := pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		results := tx.SendBatch(r.ctx, batch)
+		for range activities {
+			rows, _ := results.Query()
+			newActivity, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+			if err != nil {
+				results.Close()
+				return err
+			}
+			newActivities = append(newActivities, newActivity)
+		}
+		if err := results.Close(); err != nil {
+			return err
+		}
 
-	if activityType != nil {
-		conditions = append(conditions, fmt.Sprintf("activity_type = '%s'", *activityType))
+		revisions := &pgx.Batch{}
+		for i := range newActivities {
+			args := revisionArgs(constants.ACTIVITY_REVISION_CREATE, newActivities[i].UserId.String, nil, &newActivities[i])
+			revisions.Queue(insertRevisionQuery, args)
+		}
+
+		return tx.SendBatch(r.ctx, revisions).Close()
+	})
+	if err != nil {
+		return nil, err
 	}
-	if doneAtFrom != nil {
-		conditions = append(conditions, fmt.Sprintf("done_at >= '%s'", *doneAtFrom))
+
+	return newActivities, nil
+}
+
+// revisionFields are the fields of an activity its history tracks.
+func revisionFields(activity *models.Activity) map[string]any {
+	return map[string]any{
+		"activityType":      activity.ActivityType,
+		"doneAt":            activity.DoneAt.UTC().Format(time.RFC3339Nano),
+		"durationInMinutes": activity.DurationInMinutes,
+		"caloriesBurned":    activity.CaloriesBurned,
+		"deleted":           activity.DeletedAt.Valid,
 	}
-	if doneAtTo != nil {
-		conditions = append(conditions, fmt.Sprintf("done_at <= '%s'", *doneAtTo))
+}
+
+const insertRevisionQuery = `
+	INSERT INTO activity_revisions (activity_id, actor_id, action, before, after)
+	VALUES (@activity_id, @actor_id, @action, @before, @after)
+	`
+
+// revisionArgs holds the fields that differ between before and after, nil
+// when the activity is created. It returns nil when none changed.
+func revisionArgs(action string, actorId string, before *models.Activity, after *models.Activity) pgx.NamedArgs {
+	var beforeFields, afterFields map[string]any
+	activityId := after.Id
+	if before == nil {
+		afterFields = revisionFields(after)
+	} else {
+		beforeFields, afterFields = map[string]any{}, map[string]any{}
+		oldFields, newFields := revisionFields(before), revisionFields(after)
+		for field, value := range newFields {
+			if oldFields[field] != value {
+				beforeFields[field] = oldFields[field]
+				afterFields[field] = value
+			}
+		}
+		if len(afterFields) == 0 {
+			return nil
+		}
 	}
-	if caloriesBurnedMin != nil {
-		conditions = append(conditions, fmt.Sprintf("calories_burned >= '%s'", *caloriesBurnedMin))
+
+	return pgx.NamedArgs{
+		"activity_id": activityId,
+		"actor_id":    actorId,
+		"action":      action,
+		"before":      beforeFields,
+		"after":       afterFields,
 	}
-	if caloriesBurnedMax != nil {
-		conditions = append(conditions, fmt.Sprintf("calories_burned <= '%s'", *caloriesBurnedMax))
+}
+
+// saveRevision records the change from before to after, if any.
+func (r *ActivityRepository) saveRevision(tx pgx.Tx, action string, actorId string, before *models.Activity, after *models.Activity) error {
+	args := revisionArgs(action, actorId, before, after)
+	if args == nil {
+		return nil
 	}
 
-	query := "SELECT * FROM activities"
+	_, err := tx.Exec(r.ctx, insertRevisionQuery, args)
+
+	return err
+}
+
+// ActivityFilter narrows down the activities listed or exported, nil fields
+// don't filter.
+type ActivityFilter struct {
+	ActivityType      *string
+	DoneAtFrom        *string
+	DoneAtTo          *string
+	CaloriesBurnedMin *string
+	CaloriesBurnedMax *string
+}
+
+// where returns the conditions of the filter for the user's activities, along
+// with the arguments they bind.
+func (f ActivityFilter) where(userId string) (string, pgx.NamedArgs) {
+	conditions := []string{"user_id = @user_id", "deleted_at IS NULL"}
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
 
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
+	if f.ActivityType != nil {
+		conditions = append(conditions, "activity_type = @activity_type")
+		args["activity_type"] = *f.ActivityType
+	}
+	if f.DoneAtFrom != nil {
+		conditions = append(conditions, "done_at >= @done_at_from")
+		args["done_at_from"] = *f.DoneAtFrom
+	}
+	if f.DoneAtTo != nil {
+		conditions = append(conditions, "done_at <= @done_at_to")
+		args["done_at_to"] = *f.DoneAtTo
 	}
+	if f.CaloriesBurnedMin != nil {
+		conditions = append(conditions, "calories_burned >= @calories_burned_min")
+		args["calories_burned_min"] = *f.CaloriesBurnedMin
+	}
+	if f.CaloriesBurnedMax != nil {
+		conditions = append(conditions, "calories_burned <= @calories_burned_max")
+		args["calories_burned_max"] = *f.CaloriesBurnedMax
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+func (r *ActivityRepository) GetAllActivities(userId string, offset int, limit int, filter ActivityFilter) ([]models.Activity, error) {
+	conditions, args := filter.where(userId)
+	query := "SELECT * FROM activities WHERE " + conditions
 
 	query += `
 	ORDER BY created_at
 	LIMIT @limit
 	OFFSET @offset`
-	args := pgx.NamedArgs{
-		"limit":  limit,
-		"offset": offset,
-	}
+	args["limit"] = limit
+	args["offset"] = offset
 	rows, err := r.pgConn.Query(r.ctx, query, args)
 	if err != nil {
 		return nil, fmt.Errorf("QUERY: %#v\nARGS: %#v\nROWS: %#v\n%v", query, args, rows, err.Error())
@@ -100,40 +335,262 @@ func (r *ActivityRepository) GetAllActivities(offset int, limit int, activityTyp
 	return activities, nil
 }
 
-func (r *ActivityRepository) Update(id string, payload types.UpdateActivityPayload) (*models.Activity, error) {
-	if payload.DurationInMinutes != nil {
-		caloriesBurned := utils.CalculateCaloriesBurned(*payload.ActivityType, *payload.DurationInMinutes)
-		payload.CaloriesBurned = &caloriesBurned
+// ForEachActivity calls fn with every activity matching the filter, oldest
+// first, without holding them all in memory.
+func (r *ActivityRepository) ForEachActivity(userId string, filter ActivityFilter, fn func(models.Activity) error) error {
+	conditions, args := filter.where(userId)
+	query := "SELECT * FROM activities WHERE " + conditions + " ORDER BY done_at, id"
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		activity, err := pgx.RowToStructByName[models.Activity](rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(activity); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (r *ActivityRepository) FindById(id string, userId string) (*models.Activity, error) {
+	query := `SELECT * FROM activities WHERE id = @id AND user_id = @user_id AND deleted_at IS NULL`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	activity, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+	if err != nil {
+		return nil, err
+	}
+
+	return &activity, nil
+}
+
+// Update only applies when the activity is still at version, if given, and
+// returns pgx.ErrNoRows otherwise. The change is recorded in the activity's
+// history under the owner.
+func (r *ActivityRepository) Update(id string, userId string, version *int, payload types.UpdateActivityPayload) (*models.Activity, error) {
+	return r.update(r.pgConn, id, userId, version, payload)
+}
+
+// UpdateMany applies every update in one transaction and returns, for each,
+// the updated activity or the error it failed with. In partial mode failed
+// updates are skipped, otherwise the first one rolls back the whole batch.
+func (r *ActivityRepository) UpdateMany(userId string, payloads []types.BatchUpdateActivityPayload, partial bool) ([]*models.Activity, []error, error) {
+	activities := make([]*models.Activity, len(payloads))
+	errs := make([]error, len(payloads))
+	err := pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		for i, payload := range payloads {
+			activities[i], errs[i] = r.update(tx, payload.ActivityId, userId, nil, payload.UpdateActivityPayload)
+			if errs[i] != nil && !partial {
+				return errBatchAborted
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchAborted) {
+		return nil, nil, err
 	}
-	query, args, err := utils.BuildPartialUpdateQuery("activities", "id", id, &payload)
+
+	return activities, errs, nil
+}
+
+func (r *ActivityRepository) update(db beginner, id string, userId string, version *int, payload types.UpdateActivityPayload) (*models.Activity, error) {
+	var activity models.Activity
+	err := pgx.BeginFunc(r.ctx, db, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(r.ctx, `SELECT * FROM activities WHERE id = @id AND user_id = @user_id AND deleted_at IS NULL FOR UPDATE`, pgx.NamedArgs{
+			"id":      id,
+			"user_id": userId,
+		})
+		before, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+		if err != nil {
+			return err
+		}
+
+		// calories depend on both the type and the duration, either may change
+		if payload.ActivityType != nil || payload.DurationInMinutes != nil {
+			activityType, durationInMinutes := before.ActivityType, before.DurationInMinutes
+			if payload.ActivityType != nil {
+				activityType = *payload.ActivityType
+			}
+			if payload.DurationInMinutes != nil {
+				durationInMinutes = *payload.DurationInMinutes
+			}
+			caloriesBurned := utils.CalculateCaloriesBurned(activityType, durationInMinutes)
+			payload.CaloriesBurned = &caloriesBurned
+		}
+
+		scope := map[string]any{"user_id": userId}
+		if version != nil {
+			scope["version"] = *version
+		}
+		query, args, err := utils.BuildScopedPartialUpdateQuery("activities", "id", id, scope, &payload)
+		if err != nil {
+			return err
+		}
+		rows, _ = tx.Query(r.ctx, query, args)
+		activity, err = pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+		if err != nil {
+			return err
+		}
+
+		return r.saveRevision(tx, constants.ACTIVITY_REVISION_UPDATE, userId, &before, &activity)
+	})
 	if err != nil {
 		return nil, err
 	}
+
+	return &activity, nil
+}
+
+func (r *ActivityRepository) FindRevisions(activityId string) ([]models.ActivityRevision, error) {
+	query := `SELECT * FROM activity_revisions WHERE activity_id = @activity_id ORDER BY created_at, id`
+	args := pgx.NamedArgs{
+		"activity_id": activityId,
+	}
+
 	rows, err := r.pgConn.Query(r.ctx, query, args)
 	if err != nil {
-		return nil, fmt.Errorf("QUERY: %#v\nARGS: %#v\nROWS: %#v\n%v", query, args, rows, err.Error())
+		return nil, err
 	}
 
-	activity, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.ActivityRevision])
+}
+
+// Delete moves the activity to the trash. It only applies when the activity
+// is still at version, if given, and returns pgx.ErrNoRows otherwise.
+func (r *ActivityRepository) Delete(id string, userId string, version *int) error {
+	return r.delete(r.pgConn, id, userId, version)
+}
+
+// DeleteMany moves the activities to the trash in one transaction and
+// returns, for each, the error it failed with. In partial mode failed deletes
+// are skipped, otherwise the first one rolls back the whole batch.
+func (r *ActivityRepository) DeleteMany(userId string, ids []string, partial bool) ([]error, error) {
+	errs := make([]error, len(ids))
+	err := pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		for i, id := range ids {
+			errs[i] = r.delete(tx, id, userId, nil)
+			if errs[i] != nil && !partial {
+				return errBatchAborted
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchAborted) {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+func (r *ActivityRepository) delete(db beginner, id string, userId string, version *int) error {
+	query := `
+	UPDATE activities
+	SET deleted_at = CURRENT_TIMESTAMP
+	WHERE id = @id
+		AND user_id = @user_id
+		AND deleted_at IS NULL
+		AND (@version::integer IS NULL OR version = @version)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+		"version": version,
+	}
+
+	return pgx.BeginFunc(r.ctx, db, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(r.ctx, query, args)
+		activity, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+		if err != nil {
+			return err
+		}
+
+		before := activity
+		before.DeletedAt = pgtype.Timestamptz{}
+		return r.saveRevision(tx, constants.ACTIVITY_REVISION_DELETE, userId, &before, &activity)
+	})
+}
+
+// FindDeleted returns the activities in the user's trash, last deleted first.
+func (r *ActivityRepository) FindDeleted(userId string, offset int, limit int) ([]models.Activity, error) {
+	query := `
+	SELECT * FROM activities
+	WHERE user_id = @user_id AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC
+	LIMIT @limit
+	OFFSET @offset
+	`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+		"limit":   limit,
+		"offset":  offset,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
 	if err != nil {
-		return nil, models.NewError(http.StatusNotFound, "identityId is not found")
+		return nil, err
 	}
 
-	return &activity, nil
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Activity])
 }
 
-func (r *ActivityRepository) Delete(id string) error {
-	query := `DELETE FROM activities WHERE id = @id`
+// Restore takes the activity out of the trash, it returns pgx.ErrNoRows when
+// it isn't there.
+func (r *ActivityRepository) Restore(id string, userId string) (*models.Activity, error) {
+	query := `
+	UPDATE activities
+	SET deleted_at = NULL
+	WHERE id = @id AND user_id = @user_id AND deleted_at IS NOT NULL
+	RETURNING *
+	`
 	args := pgx.NamedArgs{
-		"id": id,
+		"id":      id,
+		"user_id": userId,
 	}
-	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+
+	var activity models.Activity
+	err := pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(r.ctx, query, args)
+		var err error
+		activity, err = pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Activity])
+		if err != nil {
+			return err
+		}
+
+		before := activity
+		before.DeletedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		return r.saveRevision(tx, constants.ACTIVITY_REVISION_RESTORE, userId, &before, &activity)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if commandTag.RowsAffected() == 0 {
-		return models.NewError(http.StatusNotFound, "")
+
+	return &activity, nil
+}
+
+// PurgeDeleted removes for good the activities in the trash for longer than
+// retention.
+func (r *ActivityRepository) PurgeDeleted(retention time.Duration) error {
+	query := `DELETE FROM activities WHERE deleted_at <= CURRENT_TIMESTAMP - @retention::interval`
+	args := pgx.NamedArgs{
+		"retention": retention,
 	}
 
-	return nil
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
 }
@@ -1,20 +1,28 @@
 package activity
 
 import (
+	"errors"
 	"fit-byte/constants"
 	"fit-byte/models"
 	"fit-byte/types"
+	"fmt"
 	"net/http"
+	"slices"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type ActivityService struct {
 	activityRepository ActivityRepository
+	trashRetention     time.Duration
 }
 
-func NewActivityService(activityRepository ActivityRepository) ActivityService {
-	return ActivityService{activityRepository}
+// NewActivityService takes how long deleted activities stay in the trash
+// before they are purged.
+func NewActivityService(activityRepository ActivityRepository, trashRetention time.Duration) ActivityService {
+	return ActivityService{activityRepository, trashRetention}
 }
 
 func (s *ActivityService) CreateActivity(activity models.Activity) (*models.Activity, error) {
@@ -26,8 +34,89 @@ func (s *ActivityService) CreateActivity(activity models.Activity) (*models.Acti
 	return newActivity, nil
 }
 
-func (s *ActivityService) GetAllActivities(offset int, limit int, activityType *string, doneAtFrom *string, doneAtTo *string, caloriesBurnedMin *string, caloriesBurnedMax *string) ([]models.Activity, error) {
-	activities, err := s.activityRepository.GetAllActivities(offset, limit, activityType, doneAtFrom, doneAtTo, caloriesBurnedMin, caloriesBurnedMax)
+// BatchResult is the outcome of one item of a batch, Err is nil when it
+// succeeded.
+type BatchResult struct {
+	Activity *models.Activity
+	Err      error
+}
+
+// RecordedActivity is an activity recorded by a device, along with its track.
+type RecordedActivity struct {
+	Activity models.Activity
+	Track    []models.TrackPoint
+}
+
+// ImportActivities creates, in one transaction, activities recorded by a
+// device, and returns a result for each of them. One taking place at the
+// same time as an activity of the user's, or as an earlier one of recorded,
+// is most likely the same one entered by hand or imported before: it is
+// skipped with a 409 error and the others are still created.
+func (s *ActivityService) ImportActivities(recorded []RecordedActivity) ([]BatchResult, error) {
+	results := make([]BatchResult, len(recorded))
+	accepted := make([]RecordedActivity, 0, len(recorded))
+	indexes := make([]int, 0, len(recorded))
+	for i, item := range recorded {
+		existing, err := s.FindOverlapping(item.Activity)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			results[i].Err = models.NewError(http.StatusConflict, fmt.Sprintf("The activity overlaps activity %s", existing.Id))
+			continue
+		}
+		if j := slices.IndexFunc(accepted, func(other RecordedActivity) bool { return Overlaps(item.Activity, other.Activity) }); j >= 0 {
+			results[i].Err = models.NewError(http.StatusConflict, fmt.Sprintf("The activity overlaps activity %d of the file", indexes[j]))
+			continue
+		}
+		accepted = append(accepted, item)
+		indexes = append(indexes, i)
+	}
+	if len(accepted) == 0 {
+		return results, nil
+	}
+
+	newActivities, err := s.activityRepository.SaveRecorded(accepted)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		results[i].Activity = &newActivities[j]
+	}
+
+	return results, nil
+}
+
+// Overlaps tells whether a and b take place at the same time.
+func Overlaps(a models.Activity, b models.Activity) bool {
+	return a.DoneAt.Before(endedAt(b)) && b.DoneAt.Before(endedAt(a))
+}
+
+func endedAt(activity models.Activity) time.Time {
+	return activity.DoneAt.Add(time.Duration(activity.DurationInMinutes) * time.Minute)
+}
+
+// FindOverlapping returns the user's activity taking place at the same time
+// as activity, if any.
+func (s *ActivityService) FindOverlapping(activity models.Activity) (*models.Activity, error) {
+	existing, err := s.activityRepository.FindOverlapping(activity.UserId.String, activity.DoneAt, endedAt(activity))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// CreateActivities creates all the activities in one transaction.
+func (s *ActivityService) CreateActivities(activities []models.Activity) ([]models.Activity, error) {
+	return s.activityRepository.SaveMany(activities)
+}
+
+func (s *ActivityService) GetAllActivities(userId string, offset int, limit int, filter ActivityFilter) ([]models.Activity, error) {
+	activities, err := s.activityRepository.GetAllActivities(userId, offset, limit, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -35,24 +124,169 @@ func (s *ActivityService) GetAllActivities(offset int, limit int, activityType *
 	return activities, err
 }
 
-func (s *ActivityService) UpdateActivity(id string, payload types.UpdateActivityPayload) (*models.Activity, error) {
-	activity, err := s.activityRepository.Update(id, payload)
+// ExportActivities calls fn with every activity matching the filter, oldest
+// first.
+func (s *ActivityService) ExportActivities(userId string, filter ActivityFilter, fn func(models.Activity) error) error {
+	return s.activityRepository.ForEachActivity(userId, filter, fn)
+}
+
+func (s *ActivityService) GetActivity(id string, userId string) (*models.Activity, error) {
+	activity, err := s.activityRepository.FindById(id, userId)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NewError(http.StatusNotFound, "")
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return nil, models.NewError(http.StatusNotFound, "")
+		}
+
 		return nil, err
 	}
 
 	return activity, nil
 }
 
-func (s *ActivityService) DeleteActivity(id string) error {
-	err := s.activityRepository.Delete(id)
+// GetActivityHistory returns the changes made to the activity, oldest first.
+func (s *ActivityService) GetActivityHistory(id string, userId string) ([]models.ActivityRevision, error) {
+	if _, err := s.GetActivity(id, userId); err != nil {
+		return nil, err
+	}
+
+	return s.activityRepository.FindRevisions(id)
+}
+
+// GetActivityTrack returns the points recorded during the activity, none
+// when it was entered by hand.
+func (s *ActivityService) GetActivityTrack(id string, userId string) ([]models.TrackPoint, error) {
+	if _, err := s.GetActivity(id, userId); err != nil {
+		return nil, err
+	}
+
+	return s.activityRepository.FindTrackPoints(id)
+}
+
+// UpdateActivity fails with 412 when version, the one the client last saw,
+// is given and the activity was modified since.
+func (s *ActivityService) UpdateActivity(id string, userId string, version *int, payload types.UpdateActivityPayload) (*models.Activity, error) {
+	activity, err := s.activityRepository.Update(id, userId, version, payload)
 	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
-			return models.NewError(http.StatusNotFound, "")
+		return nil, s.writeError(err, id, userId, version, "identityId is not found")
+	}
+
+	return activity, nil
+}
+
+// DeleteActivity fails with 412 when version, the one the client last saw,
+// is given and the activity was modified since.
+func (s *ActivityService) DeleteActivity(id string, userId string, version *int) error {
+	err := s.activityRepository.Delete(id, userId, version)
+	if err != nil {
+		return s.writeError(err, id, userId, version, "")
+	}
+
+	return nil
+}
+
+// UpdateActivities applies the updates in one transaction. Unless partial,
+// the first one that fails rolls them all back and its error is returned.
+func (s *ActivityService) UpdateActivities(userId string, payloads []types.BatchUpdateActivityPayload, partial bool) ([]BatchResult, error) {
+	activities, errs, err := s.activityRepository.UpdateMany(userId, payloads, partial)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(payloads))
+	for i, payload := range payloads {
+		if errs[i] != nil {
+			itemErr := s.writeError(errs[i], payload.ActivityId, userId, nil, "")
+			if !partial {
+				return nil, batchItemError(i, itemErr)
+			}
+			results[i].Err = itemErr
+			continue
 		}
+		results[i].Activity = activities[i]
+	}
+
+	return results, nil
+}
+
+// DeleteActivities moves the activities to the trash in one transaction.
+// Unless partial, the first one that fails rolls them all back and its error
+// is returned.
+func (s *ActivityService) DeleteActivities(userId string, ids []string, partial bool) ([]BatchResult, error) {
+	errs, err := s.activityRepository.DeleteMany(userId, ids, partial)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(ids))
+	for i, id := range ids {
+		if errs[i] != nil {
+			itemErr := s.writeError(errs[i], id, userId, nil, "")
+			if !partial {
+				return nil, batchItemError(i, itemErr)
+			}
+			results[i].Err = itemErr
+		}
+	}
+
+	return results, nil
+}
 
+// batchItemError tells which item of a batch err is about.
+func batchItemError(index int, err error) error {
+	appErr, ok := err.(*models.AppError)
+	if !ok {
 		return err
 	}
 
-	return nil
+	message := appErr.Message
+	if message == "" {
+		message = http.StatusText(appErr.Code)
+	}
+
+	return models.NewError(appErr.Code, fmt.Sprintf("item %d: %s", index, message))
+}
+
+func (s *ActivityService) GetTrash(userId string, offset int, limit int) ([]models.Activity, error) {
+	return s.activityRepository.FindDeleted(userId, offset, limit)
+}
+
+// PurgeAt is when an activity deleted at deletedAt leaves the trash for good.
+func (s *ActivityService) PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(s.trashRetention)
+}
+
+func (s *ActivityService) RestoreActivity(id string, userId string) (*models.Activity, error) {
+	activity, err := s.activityRepository.Restore(id, userId)
+	if err != nil {
+		return nil, s.writeError(err, id, userId, nil, "")
+	}
+
+	return activity, nil
+}
+
+// PurgeTrash removes the activities deleted more than the retention ago.
+func (s *ActivityService) PurgeTrash() error {
+	return s.activityRepository.PurgeDeleted(s.trashRetention)
+}
+
+// writeError tells apart, when a write matched no activity, a missing one
+// from one that isn't at version anymore.
+func (s *ActivityService) writeError(err error, id string, userId string, version *int, notFoundMessage string) error {
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+		return models.NewError(http.StatusNotFound, notFoundMessage)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	if version != nil {
+		if _, err := s.activityRepository.FindById(id, userId); err == nil {
+			return models.NewError(http.StatusPreconditionFailed, "Activity was modified")
+		}
+	}
+
+	return models.NewError(http.StatusNotFound, notFoundMessage)
 }
@@ -0,0 +1,197 @@
+package admin
+
+import (
+	"encoding/json"
+	"fit-byte/models"
+	"fit-byte/usecases/activity"
+	"fit-byte/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type AdminHandler struct {
+	adminService AdminService
+}
+
+func NewAdminHandler(adminService AdminService) AdminHandler {
+	return AdminHandler{adminService}
+}
+
+func actorFromRequest(r *http.Request) (Actor, error) {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return Actor{}, models.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	return Actor{
+		UserId: claims["userId"].(string),
+		Ip:     utils.GetClientIP(r),
+	}, nil
+}
+
+// parsePagination reads the limit and offset query params, limit defaulting
+// to 20 and capped to 100.
+func parsePagination(r *http.Request) (int, int, error) {
+	params := r.URL.Query()
+	limit := 20
+	offset := 0
+
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limitTemp, err := strconv.Atoi(limitStr)
+		if err != nil || limitTemp < 0 {
+			return 0, 0, models.NewError(http.StatusBadRequest, "limit must be a positive number")
+		}
+		limit = min(limitTemp, 100)
+	}
+	if offsetStr := params.Get("offset"); offsetStr != "" {
+		offsetTemp, err := strconv.Atoi(offsetStr)
+		if err != nil || offsetTemp < 0 {
+			return 0, 0, models.NewError(http.StatusBadRequest, "offset must be a positive number")
+		}
+		offset = offsetTemp
+	}
+
+	return offset, limit, nil
+}
+
+type userResponse struct {
+	Id               string             `json:"userId"`
+	Email            string             `json:"email"`
+	Name             pgtype.Text        `json:"name"`
+	Role             string             `json:"role"`
+	EmailVerified    bool               `json:"emailVerified"`
+	TwoFactorEnabled bool               `json:"twoFactorEnabled"`
+	DisabledAt       pgtype.Timestamptz `json:"disabledAt"`
+}
+
+func (h *AdminHandler) HandleSearchUsers(w http.ResponseWriter, r *http.Request) error {
+	offset, limit, err := parsePagination(r)
+	if err != nil {
+		return err
+	}
+	actor, err := actorFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	users, err := h.adminService.SearchUsers(actor, r.URL.Query().Get("search"), offset, limit)
+	if err != nil {
+		return err
+	}
+
+	res := make([]userResponse, 0, len(users))
+	for _, user := range users {
+		res = append(res, userResponse{
+			Id:               user.Id,
+			Email:            user.Email,
+			Name:             user.Name,
+			Role:             user.Role,
+			EmailVerified:    user.EmailVerifiedAt.Valid,
+			TwoFactorEnabled: user.TotpEnabledAt.Valid,
+			DisabledAt:       user.DisabledAt,
+		})
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *AdminHandler) HandleDisableUser(w http.ResponseWriter, r *http.Request) error {
+	return h.setUserDisabled(w, r, true)
+}
+
+func (h *AdminHandler) HandleEnableUser(w http.ResponseWriter, r *http.Request) error {
+	return h.setUserDisabled(w, r, false)
+}
+
+func (h *AdminHandler) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) error {
+	userId := r.PathValue("userId")
+	actor, err := actorFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	if err := h.adminService.SetUserDisabled(actor, userId, disabled); err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
+
+func (h *AdminHandler) HandleUpdateUserRole(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Role string `json:"role" validate:"required,oneof=USER COACH ADMIN"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	userId := r.PathValue("userId")
+	actor, err := actorFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	if err := h.adminService.SetUserRole(actor, userId, payload.Role); err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
+
+func (h *AdminHandler) HandleResetUserPassword(w http.ResponseWriter, r *http.Request) error {
+	userId := r.PathValue("userId")
+	actor, err := actorFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	if err := h.adminService.ResetUserPassword(actor, userId); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (h *AdminHandler) HandleGetUserActivities(w http.ResponseWriter, r *http.Request) error {
+	offset, limit, err := parsePagination(r)
+	if err != nil {
+		return err
+	}
+	userId := r.PathValue("userId")
+	actor, err := actorFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	activities, err := h.adminService.GetUserActivities(actor, userId, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	res := make([]activity.ActivityResponse, 0, len(activities))
+	for _, a := range activities {
+		res = append(res, activity.NewActivityResponse(a))
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
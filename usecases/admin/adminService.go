@@ -0,0 +1,175 @@
+package admin
+
+import (
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/password"
+	"fit-byte/usecases/activity"
+	"fit-byte/usecases/audit"
+	"fit-byte/usecases/auth"
+	"fit-byte/usecases/session"
+	"fit-byte/usecases/user"
+	"fit-byte/utils"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AdminService runs the moderation actions. Every one of them, reads
+// included, is recorded in the audit log under the acting admin.
+type AdminService struct {
+	userRepository     user.UserRepository
+	activityRepository activity.ActivityRepository
+	auditRepository    audit.AuditRepository
+	authService        auth.AuthService
+	sessionService     session.SessionService
+	passwordHasher     *password.Hasher
+}
+
+func NewAdminService(userRepository user.UserRepository, activityRepository activity.ActivityRepository, auditRepository audit.AuditRepository, authService auth.AuthService, sessionService session.SessionService, passwordHasher *password.Hasher) AdminService {
+	return AdminService{userRepository, activityRepository, auditRepository, authService, sessionService, passwordHasher}
+}
+
+// Actor is the admin doing an action, as recorded in the audit log.
+type Actor struct {
+	UserId string
+	Ip     string
+}
+
+func (s *AdminService) audit(actor Actor, action string, targetId string, metadata map[string]any) error {
+	auditLog := models.AuditLog{
+		ActorId:  pgtype.Text{String: actor.UserId, Valid: true},
+		Action:   action,
+		Ip:       pgtype.Text{String: actor.Ip, Valid: true},
+		Metadata: metadata,
+	}
+	if targetId != "" {
+		auditLog.TargetType = pgtype.Text{String: "user", Valid: true}
+		auditLog.TargetId = pgtype.Text{String: targetId, Valid: true}
+	}
+
+	return s.auditRepository.Save(auditLog)
+}
+
+// findUser returns a 404 for ids that aren't uuids as well as unknown ones.
+func (s *AdminService) findUser(userId string) (*models.User, error) {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return nil, models.NewError(http.StatusNotFound, "")
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NewError(http.StatusNotFound, "")
+		}
+
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *AdminService) SearchUsers(actor Actor, search string, offset int, limit int) ([]models.User, error) {
+	err := s.audit(actor, "admin.users.search", "", map[string]any{
+		"search": search,
+		"offset": offset,
+		"limit":  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userRepository.Search(search, offset, limit)
+}
+
+func (s *AdminService) SetUserDisabled(actor Actor, userId string, disabled bool) error {
+	if userId == actor.UserId {
+		return models.NewError(http.StatusBadRequest, "You can't disable your own account")
+	}
+	if _, err := s.findUser(userId); err != nil {
+		return err
+	}
+
+	if err := s.userRepository.SetDisabled(userId, disabled); err != nil {
+		return err
+	}
+	if disabled {
+		if err := s.sessionService.RevokeOtherSessions(userId, ""); err != nil {
+			return err
+		}
+	}
+
+	action := "admin.user.enable"
+	if disabled {
+		action = "admin.user.disable"
+	}
+	return s.audit(actor, action, userId, nil)
+}
+
+func (s *AdminService) SetUserRole(actor Actor, userId string, role string) error {
+	if userId == actor.UserId {
+		return models.NewError(http.StatusBadRequest, "You can't change your own role")
+	}
+	target, err := s.findUser(userId)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepository.UpdateRole(userId, role); err != nil {
+		return err
+	}
+
+	return s.audit(actor, "admin.user.role", userId, map[string]any{
+		"from": target.Role,
+		"to":   role,
+	})
+}
+
+// ResetUserPassword replaces the password with a random one and ends every
+// session, so whoever knows the current one is locked out, and mails the user
+// a reset link.
+func (s *AdminService) ResetUserPassword(actor Actor, userId string) error {
+	target, err := s.findUser(userId)
+	if err != nil {
+		return err
+	}
+
+	randomPassword, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := s.passwordHasher.Hash(randomPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepository.UpdatePassword(userId, hashedPassword); err != nil {
+		return err
+	}
+	if err := s.sessionService.RevokeOtherSessions(userId, ""); err != nil {
+		return err
+	}
+
+	if err := s.audit(actor, "admin.user.password_reset", userId, nil); err != nil {
+		return err
+	}
+
+	return s.authService.RequestPasswordReset(target.Email)
+}
+
+func (s *AdminService) GetUserActivities(actor Actor, userId string, offset int, limit int) ([]models.Activity, error) {
+	if _, err := s.findUser(userId); err != nil {
+		return nil, err
+	}
+
+	err := s.audit(actor, "admin.user.activities", userId, map[string]any{
+		"offset": offset,
+		"limit":  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.activityRepository.GetAllActivities(userId, offset, limit, activity.ActivityFilter{})
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"fit-byte/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewAuditRepository(ctx context.Context, pgConn *pgxpool.Pool) AuditRepository {
+	return AuditRepository{ctx, pgConn}
+}
+
+func (r *AuditRepository) Save(auditLog models.AuditLog) error {
+	query := `
+	INSERT INTO audit_logs (
+		actor_id,
+		action,
+		target_type,
+		target_id,
+		ip,
+		metadata
+	)
+	VALUES (
+		@actor_id,
+		@action,
+		@target_type,
+		@target_id,
+		@ip,
+		@metadata
+	)
+	`
+	metadata := auditLog.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	args := pgx.NamedArgs{
+		"actor_id":    auditLog.ActorId,
+		"action":      auditLog.Action,
+		"target_type": auditLog.TargetType,
+		"target_id":   auditLog.TargetId,
+		"ip":          auditLog.Ip,
+		"metadata":    metadata,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
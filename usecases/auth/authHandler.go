@@ -2,12 +2,17 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	"fit-byte/models"
+	"fit-byte/usecases/session"
 	"fit-byte/utils"
 
+	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -21,8 +26,9 @@ func NewAuthHandler(authService AuthService) AuthHandler {
 
 func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) error {
 	payload := struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,min=8,max=32"`
+		Email      string `json:"email" validate:"required,email"`
+		Password   string `json:"password" validate:"required"`
+		DeviceName string `json:"deviceName" validate:"max=100"`
 	}{}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		return models.NewError(http.StatusBadRequest, err.Error())
@@ -38,7 +44,7 @@ func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) err
 	newUser, err := h.authService.CreateUser(models.User{
 		Email:    payload.Email,
 		Password: payload.Password,
-	})
+	}, deviceFromRequest(r, payload.DeviceName))
 	if err != nil {
 		return err
 	}
@@ -57,8 +63,9 @@ func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) err
 
 func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) error {
 	payload := struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,min=8,max=32"`
+		Email      string `json:"email" validate:"required,email"`
+		Password   string `json:"password" validate:"required"`
+		DeviceName string `json:"deviceName" validate:"max=100"`
 	}{}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		return models.NewError(http.StatusBadRequest, err.Error())
@@ -71,9 +78,59 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) error
 		}
 	}
 
-	user, err := h.authService.Login(payload.Email, payload.Password)
+	user, err := h.authService.Login(payload.Email, payload.Password, deviceFromRequest(r, payload.DeviceName))
 	if err != nil {
-		return err
+		return lockedOutResponse(w, err)
+	}
+
+	if user.TotpEnabledAt.Valid {
+		res := struct {
+			Email             string `json:"email"`
+			TwoFactorRequired bool   `json:"twoFactorRequired"`
+			ChallengeToken    string `json:"challengeToken"`
+		}{
+			Email:             user.Email,
+			TwoFactorRequired: true,
+			ChallengeToken:    user.Token,
+		}
+		utils.SetJsonResponse(w, http.StatusOK, res)
+
+		return nil
+	}
+
+	res := struct {
+		Email string `json:"email"`
+		Token string `json:"token"`
+	}{
+		Email: user.Email,
+		Token: user.Token,
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *AuthHandler) HandleLoginTwoFactor(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		ChallengeToken string `json:"challengeToken" validate:"required"`
+		Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+		RecoveryCode   string `json:"recoveryCode" validate:"required_without=Code"`
+		DeviceName     string `json:"deviceName" validate:"max=100"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	user, err := h.authService.CompleteTwoFactorLogin(payload.ChallengeToken, payload.Code, payload.RecoveryCode, deviceFromRequest(r, payload.DeviceName))
+	if err != nil {
+		return lockedOutResponse(w, err)
 	}
 
 	res := struct {
@@ -86,4 +143,203 @@ func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) error
 	utils.SetJsonResponse(w, http.StatusOK, res)
 
 	return nil
-}
\ No newline at end of file
+}
+
+func deviceFromRequest(r *http.Request, deviceName string) session.Device {
+	return session.Device{
+		Name:      deviceName,
+		UserAgent: r.UserAgent(),
+		Ip:        utils.GetClientIP(r),
+	}
+}
+
+// lockedOutResponse turns a LockedOutError into a 429 telling when to retry,
+// and passes any other error through.
+func lockedOutResponse(w http.ResponseWriter, err error) error {
+	var lockedOutErr *LockedOutError
+	if errors.As(err, &lockedOutErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedOutErr.RetryAfter.Seconds()))))
+		return models.NewError(http.StatusTooManyRequests, lockedOutErr.Error())
+	}
+
+	return err
+}
+
+func (h *AuthHandler) HandleChangePassword(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		CurrentPassword string `json:"currentPassword" validate:"required"`
+		NewPassword     string `json:"newPassword" validate:"required"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+	sessionId, _ := claims["sid"].(string)
+
+	err = h.authService.ChangePassword(userId, sessionId, payload.CurrentPassword, payload.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
+
+func (h *AuthHandler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Email string `json:"email" validate:"required,email"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	if err := h.authService.RequestPasswordReset(payload.Email); err != nil {
+		return err
+	}
+
+	// same answer whether the email is registered or not
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (h *AuthHandler) HandleResetPassword(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Token       string `json:"token" validate:"required"`
+		NewPassword string `json:"newPassword" validate:"required"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	if err := h.authService.ResetPassword(payload.Token, payload.NewPassword); err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
+
+func (h *AuthHandler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Token string `json:"token" validate:"required"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	if err := h.authService.VerifyEmail(payload.Token); err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
+
+func (h *AuthHandler) HandleResendEmailVerification(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	if err := h.authService.ResendEmailVerification(userId); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (h *AuthHandler) HandleChangeEmail(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Email    string `json:"email" validate:"required,email"`
+		Password string `json:"password" validate:"required"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	if err := h.authService.RequestEmailChange(userId, payload.Password, payload.Email); err != nil {
+		return err
+	}
+
+	// the email changes once the link mailed to the new address is opened
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (h *AuthHandler) HandleConfirmEmailChange(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Token string `json:"token" validate:"required"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	if err := h.authService.ConfirmEmailChange(payload.Token); err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
@@ -1,31 +1,94 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fit-byte/constants"
+	"fit-byte/jwtkeys"
+	"fit-byte/mailer"
+	"fit-byte/password"
+	"fit-byte/usecases/audit"
+	"fit-byte/usecases/session"
 	"fit-byte/models"
+	"fit-byte/usecases/twofactor"
 	"fit-byte/usecases/user"
 	"fit-byte/utils"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type AuthService struct {
-	userRepository user.UserRepository
+	userRepository          user.UserRepository
+	tokenRepository         TokenRepository
+	loginThrottleRepository LoginThrottleRepository
+	auditRepository         audit.AuditRepository
+	mailSender              mailer.Sender
+	twoFactorService        twofactor.TwoFactorService
+	keySet                  *jwtkeys.KeySet
+	sessionService          session.SessionService
+	passwordHasher          *password.Hasher
+	passwordPolicy          password.Policy
+	// dummyPasswordHash is checked against when the email is unknown, so a
+	// login takes as long whether the account exists or not
+	dummyPasswordHash string
 }
 
-func NewAuthService(userRepository user.UserRepository) AuthService {
-	return AuthService{userRepository}
+func NewAuthService(userRepository user.UserRepository, tokenRepository TokenRepository, loginThrottleRepository LoginThrottleRepository, auditRepository audit.AuditRepository, mailSender mailer.Sender, twoFactorService twofactor.TwoFactorService, keySet *jwtkeys.KeySet, sessionService session.SessionService, passwordHasher *password.Hasher, passwordPolicy password.Policy) AuthService {
+	dummyPasswordHash, _ := passwordHasher.Hash("dummy password")
+	return AuthService{userRepository, tokenRepository, loginThrottleRepository, auditRepository, mailSender, twoFactorService, keySet, sessionService, passwordHasher, passwordPolicy, dummyPasswordHash}
 }
 
-func (s *AuthService) CreateUser(user models.User) (*models.User, error) {
-	hashedPassword, err := utils.HashPassword(user.Password)
+// hashNewPassword checks newPassword against the password policy and hashes
+// it.
+func (s *AuthService) hashNewPassword(newPassword string) (string, error) {
+	if err := s.passwordPolicy.Check(newPassword); err != nil {
+		return "", models.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	return s.passwordHasher.Hash(newPassword)
+}
+
+// startSession records a login of user from device and sets the access token
+// of that session on user.
+func (s *AuthService) startSession(user *models.User, device session.Device) error {
+	newSession, err := s.sessionService.CreateSession(user.Id, device)
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.CreateClaims(s.keySet, user, newSession.Id)
+	if err != nil {
+		return err
+	}
+
+	user.Token = token
+	return nil
+}
+
+// LockedOutError is returned by Login while the account or the client is
+// locked out after too many failed attempts.
+type LockedOutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedOutError) Error() string {
+	return "Too many failed login attempts, try again later"
+}
+
+func (s *AuthService) CreateUser(user models.User, device session.Device) (*models.User, error) {
+	hashedPassword, err := s.hashNewPassword(user.Password)
 	if err != nil {
 		return nil, err
 	}
 	user.Password = hashedPassword
+	user.Email = utils.NormalizeEmail(user.Email)
 
 	newUser, err := s.userRepository.Save(user)
 	if err != nil {
@@ -35,35 +98,450 @@ func (s *AuthService) CreateUser(user models.User) (*models.User, error) {
 		return nil, err
 	}
 
-	token, err := utils.CreateClaims(newUser)
-	if err != nil {
+	if err := s.startSession(newUser, device); err != nil {
 		return nil, err
 	}
-	newUser.Token = token
+
+	// the account is usable right away, a failed email can be sent again
+	if err := s.sendEmailVerification(newUser); err != nil {
+		log.Println("Error sending email verification:", err)
+	}
 
 	return newUser, nil
 }
 
-func (s *AuthService) Login(email string, password string) (*models.User, error) {
-	user, err := s.userRepository.FindByEmail(email)
+// Login answers the same way for unknown emails and wrong passwords. Failures
+// are counted per account and per client ip, each one getting locked out for
+// an exponentially growing time once it has failed too often. Users having
+// two-factor authentication enabled get a challenge token instead of an access
+// token, to be exchanged with CompleteTwoFactorLogin.
+func (s *AuthService) Login(email string, password string, device session.Device) (*models.User, error) {
+	ip := device.Ip
+	accountKey := "email:" + utils.NormalizeEmail(email)
+	ipKey := "ip:" + ip
+
+	lockedUntil, err := s.loginThrottleRepository.FindLockedUntil(accountKey, ipKey)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, models.NewError(http.StatusNotFound, "Email is not exist")
+		return nil, err
+	}
+	if !lockedUntil.IsZero() {
+		return nil, &LockedOutError{RetryAfter: time.Until(lockedUntil)}
+	}
+
+	user, err := s.userRepository.FindByEmail(email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	passwordHash := s.dummyPasswordHash
+	if user != nil {
+		passwordHash = user.Password
+	}
+	match, needsRehash := s.passwordHasher.Verify(passwordHash, password)
+	if user == nil || !match {
+		if err := s.recordLoginFailure(accountKey, constants.LOGIN_ACCOUNT_MAX_FAILURES, ip, user); err != nil {
+			return nil, err
 		}
+		if err := s.recordLoginFailure(ipKey, constants.LOGIN_IP_MAX_FAILURES, ip, user); err != nil {
+			return nil, err
+		}
+
+		return nil, models.NewError(http.StatusUnauthorized, "Invalid email/password")
+	}
 
+	if err := s.loginThrottleRepository.Reset(accountKey); err != nil {
 		return nil, err
 	}
+	if needsRehash {
+		s.rehashPassword(user, password)
+	}
+	if user.DisabledAt.Valid {
+		return nil, models.NewError(http.StatusForbidden, "Account is disabled")
+	}
 
-	match := utils.CheckPasswordHash(user.Password, password)
-	if match {
-		token, err := utils.CreateClaims(user)
+	if user.TotpEnabledAt.Valid {
+		challengeToken, err := utils.CreateChallengeToken(s.keySet, user)
 		if err != nil {
 			return nil, err
 		}
 
-		user.Token = token
+		user.Token = challengeToken
 		return user, nil
-	} else {
-		return nil, models.NewError(http.StatusUnauthorized, "Invalid email/password")
 	}
-}
\ No newline at end of file
+
+	if err := s.startSession(user, device); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CompleteTwoFactorLogin exchanges the challenge token of a login for an
+// access token, given a code from the user's app or one of their recovery
+// codes. Wrong codes are throttled like wrong passwords.
+func (s *AuthService) CompleteTwoFactorLogin(challengeToken string, code string, recoveryCode string, device session.Device) (*models.User, error) {
+	ip := device.Ip
+	token, err := s.keySet.Verify(challengeToken)
+	if err != nil {
+		return nil, models.NewError(http.StatusUnauthorized, "Invalid or expired challenge token")
+	}
+	claims := token.PrivateClaims()
+	userId, ok := claims["userId"].(string)
+	if !ok || claims["purpose"] != constants.TOKEN_PURPOSE_TWO_FACTOR_CHALLENGE {
+		return nil, models.NewError(http.StatusUnauthorized, "Invalid or expired challenge token")
+	}
+
+	twoFactorKey := "2fa:" + userId
+	ipKey := "ip:" + ip
+
+	lockedUntil, err := s.loginThrottleRepository.FindLockedUntil(twoFactorKey, ipKey)
+	if err != nil {
+		return nil, err
+	}
+	if !lockedUntil.IsZero() {
+		return nil, &LockedOutError{RetryAfter: time.Until(lockedUntil)}
+	}
+
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt.Valid {
+		return nil, models.NewError(http.StatusForbidden, "Account is disabled")
+	}
+
+	ok, err = s.twoFactorService.Verify(user, code, recoveryCode)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := s.recordLoginFailure(twoFactorKey, constants.LOGIN_ACCOUNT_MAX_FAILURES, ip, user); err != nil {
+			return nil, err
+		}
+		if err := s.recordLoginFailure(ipKey, constants.LOGIN_IP_MAX_FAILURES, ip, user); err != nil {
+			return nil, err
+		}
+
+		return nil, models.NewError(http.StatusUnauthorized, "Invalid code")
+	}
+
+	if err := s.loginThrottleRepository.Reset(twoFactorKey); err != nil {
+		return nil, err
+	}
+
+	if err := s.startSession(user, device); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *AuthService) recordLoginFailure(key string, maxFailures int, ip string, user *models.User) error {
+	failedAttempts, err := s.loginThrottleRepository.RecordFailure(key, constants.LOGIN_FAILURE_WINDOW)
+	if err != nil {
+		return err
+	}
+	if failedAttempts < maxFailures {
+		return nil
+	}
+
+	// the lockout doubles with every failure past the limit
+	lockout := constants.LOGIN_LOCKOUT_MAX
+	if excess := failedAttempts - maxFailures; excess < 16 {
+		lockout = min(constants.LOGIN_LOCKOUT_BASE<<excess, constants.LOGIN_LOCKOUT_MAX)
+	}
+	lockedUntil := time.Now().Add(lockout)
+	if err := s.loginThrottleRepository.Lock(key, lockedUntil); err != nil {
+		return err
+	}
+
+	metadata := map[string]any{
+		"failedAttempts": failedAttempts,
+		"lockedUntil":    lockedUntil,
+	}
+	if user != nil {
+		metadata["userId"] = user.Id
+	}
+	return s.auditRepository.Save(models.AuditLog{
+		Action:     "auth.lockout",
+		TargetType: pgtype.Text{String: "login", Valid: true},
+		TargetId:   pgtype.Text{String: key, Valid: true},
+		Ip:         pgtype.Text{String: ip, Valid: true},
+		Metadata:   metadata,
+	})
+}
+
+// rehashPassword upgrades the hash of the user's password to the current
+// algorithm and cost. Failing only delays it to the next login.
+func (s *AuthService) rehashPassword(user *models.User, password string) {
+	hashedPassword, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		log.Println("Error rehashing password:", err)
+		return
+	}
+
+	if err := s.userRepository.UpdatePassword(user.Id, hashedPassword); err != nil {
+		log.Println("Error rehashing password:", err)
+		return
+	}
+	user.Password = hashedPassword
+}
+
+// issueToken creates a single-use token for purpose and returns it in plain
+// text, to be mailed to the user.
+func (s *AuthService) issueToken(userId string, purpose string, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.tokenRepository.Save(models.UserToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *AuthService) sendEmailVerification(user *models.User) error {
+	token, err := s.issueToken(user.Id, constants.TOKEN_PURPOSE_EMAIL_VERIFICATION, constants.EMAIL_VERIFICATION_TOKEN_TTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailSender.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Welcome to FitByte!\n\nConfirm your email address by opening %s/verify-email?token=%s\n\nThe link expires in %s.",
+			os.Getenv("APP_URL"), token, constants.EMAIL_VERIFICATION_TOKEN_TTL,
+		),
+	})
+}
+
+func (s *AuthService) ResendEmailVerification(userId string) error {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt.Valid {
+		return models.NewError(http.StatusConflict, "Email is already verified")
+	}
+
+	return s.sendEmailVerification(user)
+}
+
+func (s *AuthService) VerifyEmail(token string) error {
+	userToken, err := s.tokenRepository.Consume(constants.TOKEN_PURPOSE_EMAIL_VERIFICATION, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NewError(http.StatusBadRequest, "Invalid or expired token")
+		}
+
+		return err
+	}
+
+	return s.userRepository.MarkEmailVerified(userToken.UserId)
+}
+
+// RequestEmailChange mails a confirmation link to newEmail, the email is only
+// swapped once it is opened so a typo can't lock the user out. The current
+// address is told about the request.
+func (s *AuthService) RequestEmailChange(userId string, password string, newEmail string) error {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return err
+	}
+	if match, _ := s.passwordHasher.Verify(user.Password, password); !match {
+		return models.NewError(http.StatusUnauthorized, "Invalid password")
+	}
+
+	newEmail = utils.NormalizeEmail(newEmail)
+	if newEmail == user.Email {
+		return models.NewError(http.StatusBadRequest, "Email is unchanged")
+	}
+	_, err = s.userRepository.FindByEmail(newEmail)
+	if err == nil {
+		return models.NewError(http.StatusConflict, "Email is already taken")
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+	err = s.tokenRepository.Save(models.UserToken{
+		UserId:    user.Id,
+		Purpose:   constants.TOKEN_PURPOSE_EMAIL_CHANGE,
+		TokenHash: utils.HashToken(token),
+		Email:     pgtype.Text{String: newEmail, Valid: true},
+		ExpiresAt: time.Now().Add(constants.EMAIL_CHANGE_TOKEN_TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.mailSender.Send(context.Background(), mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf(
+			"Confirm this is the new email address of your FitByte account by opening %s/confirm-email-change?token=%s\n\nThe link expires in %s.",
+			os.Getenv("APP_URL"), token, constants.EMAIL_CHANGE_TOKEN_TTL,
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	// a warning only, the change can't happen without the new address
+	err = s.mailSender.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Your email is about to change",
+		Body: fmt.Sprintf(
+			"Someone asked to change the email of your FitByte account to %s. If it wasn't you, change your password.",
+			newEmail,
+		),
+	})
+	if err != nil {
+		log.Println("Error sending email change notice:", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange swaps the user's email for the one the token was mailed
+// to.
+func (s *AuthService) ConfirmEmailChange(token string) error {
+	userToken, err := s.tokenRepository.Consume(constants.TOKEN_PURPOSE_EMAIL_CHANGE, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NewError(http.StatusBadRequest, "Invalid or expired token")
+		}
+
+		return err
+	}
+
+	user, err := s.userRepository.FindById(userToken.UserId)
+	if err != nil {
+		return err
+	}
+
+	err = s.userRepository.UpdateEmail(user.Id, userToken.Email.String)
+	if err != nil {
+		// someone registered with it since the request
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.UNIQUE_VIOLATION_ERROR_CODE {
+			return models.NewError(http.StatusConflict, "Email is already taken")
+		}
+		return err
+	}
+
+	return s.auditRepository.Save(models.AuditLog{
+		ActorId:    pgtype.Text{String: user.Id, Valid: true},
+		Action:     "user.email_changed",
+		TargetType: pgtype.Text{String: "user", Valid: true},
+		TargetId:   pgtype.Text{String: user.Id, Valid: true},
+		Metadata: map[string]any{
+			"previousEmail": user.Email,
+			"email":         userToken.Email.String,
+		},
+	})
+}
+
+// ChangePassword logs the user out of their other sessions, sessionId being
+// the one making the change.
+func (s *AuthService) ChangePassword(userId string, sessionId string, currentPassword string, newPassword string) error {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return err
+	}
+	if match, _ := s.passwordHasher.Verify(user.Password, currentPassword); !match {
+		return models.NewError(http.StatusUnauthorized, "Invalid current password")
+	}
+
+	hashedPassword, err := s.hashNewPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepository.UpdatePassword(user.Id, hashedPassword); err != nil {
+		return err
+	}
+
+	return s.sessionService.RevokeOtherSessions(user.Id, sessionId)
+}
+
+// RequestPasswordReset mails a reset link when the email belongs to a user.
+// It never tells whether it does, to not leak which emails are registered:
+// the link is issued and mailed in the background, so that the answer takes
+// as long either way.
+func (s *AuthService) RequestPasswordReset(email string) error {
+	user, err := s.userRepository.FindByEmail(email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+
+		return err
+	}
+
+	go func() {
+		if err := s.sendPasswordReset(user); err != nil {
+			log.Println("Error sending password reset:", err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *AuthService) sendPasswordReset(user *models.User) error {
+	token, err := s.issueToken(user.Id, constants.TOKEN_PURPOSE_PASSWORD_RESET, constants.PASSWORD_RESET_TOKEN_TTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailSender.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your FitByte account.\n\nChoose a new one by opening %s/reset-password?token=%s\n\nThe link expires in %s. If it wasn't you, you can ignore this email.",
+			os.Getenv("APP_URL"), token, constants.PASSWORD_RESET_TOKEN_TTL,
+		),
+	})
+}
+
+// ResetPassword sets the password with a token from RequestPasswordReset. The
+// password is checked against the policy before the token is used up, so that
+// a rejected one can be followed by another try with the same link.
+func (s *AuthService) ResetPassword(token string, newPassword string) error {
+	if err := s.passwordPolicy.Check(newPassword); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	userToken, err := s.tokenRepository.Consume(constants.TOKEN_PURPOSE_PASSWORD_RESET, utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.NewError(http.StatusBadRequest, "Invalid or expired token")
+		}
+
+		return err
+	}
+
+	hashedPassword, err := s.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepository.UpdatePassword(userToken.UserId, hashedPassword); err != nil {
+		return err
+	}
+
+	// whoever knew the old password is logged out too
+	return s.sessionService.RevokeOtherSessions(userToken.UserId, "")
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LoginThrottleRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewLoginThrottleRepository(ctx context.Context, pgConn *pgxpool.Pool) LoginThrottleRepository {
+	return LoginThrottleRepository{ctx, pgConn}
+}
+
+// FindLockedUntil returns until when any of keys is locked, or the zero time
+// when none is.
+func (r *LoginThrottleRepository) FindLockedUntil(keys ...string) (time.Time, error) {
+	query := `
+	SELECT MAX(locked_until)
+	FROM login_throttles
+	WHERE key = ANY(@keys) AND locked_until > CURRENT_TIMESTAMP
+	`
+	args := pgx.NamedArgs{
+		"keys": keys,
+	}
+
+	var lockedUntil *time.Time
+	if err := r.pgConn.QueryRow(r.ctx, query, args).Scan(&lockedUntil); err != nil {
+		return time.Time{}, err
+	}
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+
+	return *lockedUntil, nil
+}
+
+// RecordFailure counts a failed attempt for key and returns the number of
+// failures in a row. The count starts over once window has passed since the
+// previous failure.
+func (r *LoginThrottleRepository) RecordFailure(key string, window time.Duration) (int, error) {
+	query := `
+	INSERT INTO login_throttles (key, failed_attempts, last_failed_at)
+	VALUES (@key, 1, CURRENT_TIMESTAMP)
+	ON CONFLICT (key) DO UPDATE SET
+		failed_attempts = CASE
+			WHEN login_throttles.last_failed_at < CURRENT_TIMESTAMP - @window::interval THEN 1
+			ELSE login_throttles.failed_attempts + 1
+		END,
+		last_failed_at = CURRENT_TIMESTAMP
+	RETURNING failed_attempts
+	`
+	args := pgx.NamedArgs{
+		"key":    key,
+		"window": window,
+	}
+
+	var failedAttempts int
+	if err := r.pgConn.QueryRow(r.ctx, query, args).Scan(&failedAttempts); err != nil {
+		return 0, err
+	}
+
+	return failedAttempts, nil
+}
+
+func (r *LoginThrottleRepository) Lock(key string, until time.Time) error {
+	query := `UPDATE login_throttles SET locked_until = @locked_until WHERE key = @key`
+	args := pgx.NamedArgs{
+		"key":          key,
+		"locked_until": until,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+func (r *LoginThrottleRepository) Reset(key string) error {
+	query := `DELETE FROM login_throttles WHERE key = @key`
+	args := pgx.NamedArgs{
+		"key": key,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
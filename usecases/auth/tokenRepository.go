@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"fit-byte/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TokenRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewTokenRepository(ctx context.Context, pgConn *pgxpool.Pool) TokenRepository {
+	return TokenRepository{ctx, pgConn}
+}
+
+// Save stores a new token and invalidates the unused ones the user had for
+// the same purpose, so only the latest email works.
+func (r *TokenRepository) Save(token models.UserToken) error {
+	return pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(r.ctx, `
+		UPDATE user_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = @user_id AND purpose = @purpose AND used_at IS NULL
+		`, pgx.NamedArgs{
+			"user_id": token.UserId,
+			"purpose": token.Purpose,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(r.ctx, `
+		INSERT INTO user_tokens (
+			user_id,
+			purpose,
+			token_hash,
+			email,
+			expires_at
+		)
+		VALUES (
+			@user_id,
+			@purpose,
+			@token_hash,
+			@email,
+			@expires_at
+		)
+		`, pgx.NamedArgs{
+			"user_id":    token.UserId,
+			"purpose":    token.Purpose,
+			"token_hash": token.TokenHash,
+			"email":      token.Email,
+			"expires_at": token.ExpiresAt,
+		})
+		return err
+	})
+}
+
+// Consume marks the token as used and returns it, as long as it is unused and
+// not expired. It returns pgx.ErrNoRows otherwise. Marking and checking happen
+// in one statement so a token can't be used twice concurrently.
+func (r *TokenRepository) Consume(purpose string, tokenHash string) (*models.UserToken, error) {
+	query := `
+	UPDATE user_tokens
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE token_hash = @token_hash
+		AND purpose = @purpose
+		AND used_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"purpose":    purpose,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	token, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.UserToken])
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
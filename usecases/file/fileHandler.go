@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+
+	"github.com/go-chi/jwtauth/v5"
 )
 
 type FileHandler struct {
@@ -49,7 +51,13 @@ func (h *FileHandler) HandleUploadFile(w http.ResponseWriter, r *http.Request) e
 		return models.NewError(http.StatusBadRequest, "File exceeds 100KB")
 	}
 
-	s3FileKey, err := h.fileService.UploadToS3(file, fileHeader)
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	s3FileKey, err := h.fileService.UploadToS3(userId, file, fileHeader)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,64 @@
+package file
+
+import (
+	"context"
+	"fit-byte/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type FileRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewFileRepository(ctx context.Context, pgConn *pgxpool.Pool) FileRepository {
+	return FileRepository{ctx, pgConn}
+}
+
+func (r *FileRepository) Save(file models.UploadedFile) error {
+	query := `
+	INSERT INTO uploaded_files (
+		user_id,
+		key,
+		content_type,
+		size
+	)
+	VALUES (
+		@user_id,
+		@key,
+		@content_type,
+		@size
+	)
+	`
+	args := pgx.NamedArgs{
+		"user_id":      file.UserId,
+		"key":          file.Key,
+		"content_type": file.ContentType,
+		"size":         file.Size,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+func (r *FileRepository) FindAllByUserId(userId string) ([]models.UploadedFile, error) {
+	query := `SELECT * FROM uploaded_files WHERE user_id = @user_id ORDER BY created_at`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.UploadedFile])
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
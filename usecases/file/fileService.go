@@ -3,6 +3,7 @@ package file
 import (
 	"bytes"
 	"context"
+	"fit-byte/models"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -11,18 +12,23 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type FileService struct {
 	s3Client *s3.Client
 	ctx context.Context
+	fileRepository FileRepository
 }
 
-func NewFileService(s3Client *s3.Client, ctx context.Context) FileService {
-	return FileService{s3Client, ctx}
+func NewFileService(s3Client *s3.Client, ctx context.Context, fileRepository FileRepository) FileService {
+	return FileService{s3Client, ctx, fileRepository}
 }
 
-func (s *FileService) UploadToS3(file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
+// UploadToS3 stores a public file of the user and records it, so it is
+// removed along with their account.
+func (s *FileService) UploadToS3(userId string, file multipart.File, fileHeader *multipart.FileHeader) (string, error) {
 	defer file.Close()
 
 	buf := bytes.NewBuffer(nil)
@@ -30,16 +36,97 @@ func (s *FileService) UploadToS3(file multipart.File, fileHeader *multipart.File
 		return "", fmt.Errorf("failed to read file: %v", err)
 	}
 	key := fmt.Sprintf("%d-%s", time.Now().Unix(), fileHeader.Filename)
+	contentType := fileHeader.Header.Get("Content-Type")
 	_, err := s.s3Client.PutObject(s.ctx, &s3.PutObjectInput{
 		Bucket: aws.String(os.Getenv("S3_BUCKET_NAME")),
-		Key:    aws.String(fmt.Sprintf("%d-%s", time.Now().Unix(), fileHeader.Filename)),
+		Key:    aws.String(key),
 		Body:   bytes.NewReader(buf.Bytes()),
 		ACL:    "public-read",
-		ContentType: aws.String(fileHeader.Header.Get("Content-Type")),
+		ContentType: aws.String(contentType),
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to upload file to S3: %v", err)
 	}
+
+	err = s.fileRepository.Save(models.UploadedFile{
+		UserId:      userId,
+		Key:         key,
+		ContentType: pgtype.Text{String: contentType, Valid: contentType != ""},
+		Size:        int64(buf.Len()),
+	})
+	if err != nil {
+		return "", err
+	}
 	
 	return key, nil
-}
\ No newline at end of file
+}
+
+func (s *FileService) FindUserFiles(userId string) ([]models.UploadedFile, error) {
+	return s.fileRepository.FindAllByUserId(userId)
+}
+
+// PutPrivateObject stores a file only reachable through PresignGetObject.
+func (s *FileService) PutPrivateObject(key string, body io.Reader, contentType string) error {
+	_, err := s.s3Client.PutObject(s.ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(os.Getenv("S3_BUCKET_NAME")),
+		Key:         aws.String(key),
+		Body:        body,
+		ACL:         "private",
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file to S3: %v", err)
+	}
+
+	return nil
+}
+
+func (s *FileService) GetObject(key string) (io.ReadCloser, error) {
+	output, err := s.s3Client.GetObject(s.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(os.Getenv("S3_BUCKET_NAME")),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from S3: %v", err)
+	}
+
+	return output.Body, nil
+}
+
+// PresignGetObject returns a link downloading the file for ttl.
+func (s *FileService) PresignGetObject(key string, ttl time.Duration) (string, error) {
+	request, err := s3.NewPresignClient(s.s3Client).PresignGetObject(s.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(os.Getenv("S3_BUCKET_NAME")),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 url: %v", err)
+	}
+
+	return request.URL, nil
+}
+
+// DeleteObjects removes the files from S3, keys that don't exist are ignored.
+func (s *FileService) DeleteObjects(keys []string) error {
+	// S3 deletes at most 1000 objects per request
+	for start := 0; start < len(keys); start += 1000 {
+		end := min(start+1000, len(keys))
+		objects := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		output, err := s.s3Client.DeleteObjects(s.ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(os.Getenv("S3_BUCKET_NAME")),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete files from S3: %v", err)
+		}
+		if len(output.Errors) > 0 {
+			return fmt.Errorf("failed to delete %s from S3: %s", aws.ToString(output.Errors[0].Key), aws.ToString(output.Errors[0].Message))
+		}
+	}
+
+	return nil
+}
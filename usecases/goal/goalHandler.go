@@ -0,0 +1,148 @@
+package goal
+
+import (
+	"encoding/json"
+	"fit-byte/models"
+	"fit-byte/utils"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type GoalHandler struct {
+	goalService GoalService
+}
+
+func NewGoalHandler(goalService GoalService) GoalHandler {
+	return GoalHandler{goalService}
+}
+
+func (h *GoalHandler) HandleCreateGoal(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Name         *string `json:"name" validate:"omitempty,min=2,max=60"`
+		Metric       string  `json:"metric" validate:"required,oneof=ACTIVE_MINUTES CALORIES_BURNED ACTIVITY_COUNT"`
+		Period       string  `json:"period" validate:"required,oneof=DAY WEEK MONTH"`
+		Target       int     `json:"target" validate:"required,min=1"`
+		ActivityType *string `json:"activityType" validate:"omitempty,oneof=Walking Yoga Stretching Cycling Swimming Dancing Hiking Running HIIT JumpRope"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	goal := models.Goal{
+		UserId: userId,
+		Metric: payload.Metric,
+		Period: payload.Period,
+		Target: payload.Target,
+	}
+	if payload.Name != nil {
+		goal.Name = pgtype.Text{String: *payload.Name, Valid: true}
+	}
+	if payload.ActivityType != nil {
+		goal.ActivityType = pgtype.Text{String: *payload.ActivityType, Valid: true}
+	}
+
+	newGoal, err := h.goalService.CreateGoal(goal)
+	if err != nil {
+		return err
+	}
+
+	utils.SetJsonResponse(w, http.StatusCreated, newGoal)
+
+	return nil
+}
+
+func (h *GoalHandler) HandleGetGoals(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	goals, err := h.goalService.GetGoalsWithProgress(userId)
+	if err != nil {
+		return err
+	}
+
+	type progressResponse struct {
+		PeriodStart time.Time `json:"periodStart"`
+		PeriodEnd   time.Time `json:"periodEnd"`
+		Achieved    int       `json:"achieved"`
+		Percentage  float64   `json:"percentage"`
+		Completed   bool      `json:"completed"`
+	}
+	type goalResponse struct {
+		models.Goal
+		Progress progressResponse `json:"progress"`
+	}
+
+	res := make([]goalResponse, 0, len(goals))
+	for _, goal := range goals {
+		res = append(res, goalResponse{
+			Goal: goal.Goal,
+			Progress: progressResponse{
+				PeriodStart: goal.PeriodStart,
+				PeriodEnd:   goal.PeriodEnd,
+				Achieved:    goal.Achieved,
+				Percentage:  float64(goal.Achieved) / float64(goal.Target) * 100,
+				Completed:   goal.Achieved >= goal.Target,
+			},
+		})
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *GoalHandler) HandleGetGoalHistory(w http.ResponseWriter, r *http.Request) error {
+	goalId := r.PathValue("goalId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	periods, err := h.goalService.GetGoalHistory(goalId, userId)
+	if err != nil {
+		return err
+	}
+
+	utils.SetJsonResponse(w, http.StatusOK, periods)
+
+	return nil
+}
+
+func (h *GoalHandler) HandleDeleteGoal(w http.ResponseWriter, r *http.Request) error {
+	goalId := r.PathValue("goalId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	err = h.goalService.DeleteGoal(goalId, userId)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
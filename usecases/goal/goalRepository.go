@@ -0,0 +1,218 @@
+package goal
+
+import (
+	"context"
+	"fit-byte/models"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// achievedQuery sums the goal's metric over the activities done inside the
+// period p. It is meant to be used in a lateral join next to goals g.
+const achievedQuery = `
+	SELECT COALESCE(CASE g.metric
+		WHEN 'ACTIVE_MINUTES' THEN SUM(a.duration_in_minutes)
+		WHEN 'CALORIES_BURNED' THEN SUM(a.calories_burned)
+		ELSE COUNT(*)
+	END, 0) AS achieved
+	FROM activities a
+	WHERE a.user_id = g.user_id
+		AND a.deleted_at IS NULL
+		AND a.done_at >= p.period_start
+		AND a.done_at < p.period_end
+		AND (g.activity_type IS NULL OR a.activity_type = g.activity_type)
+`
+
+type GoalRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewGoalRepository(ctx context.Context, pgConn *pgxpool.Pool) GoalRepository {
+	return GoalRepository{ctx, pgConn}
+}
+
+func (r *GoalRepository) Save(goal models.Goal) (*models.Goal, error) {
+	query := `
+	INSERT INTO goals (
+		user_id,
+		name,
+		metric,
+		period,
+		target,
+		activity_type
+	)
+	VALUES (
+		@user_id,
+		@name,
+		@metric,
+		@period,
+		@target,
+		@activity_type
+	)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"user_id":       goal.UserId,
+		"name":          goal.Name,
+		"metric":        goal.Metric,
+		"period":        goal.Period,
+		"target":        goal.Target,
+		"activity_type": goal.ActivityType,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	newGoal, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Goal])
+	if err != nil {
+		return nil, err
+	}
+
+	return &newGoal, nil
+}
+
+// FindAllWithProgress returns the goals of the user along with how far they
+// are into their current period.
+//
+// Period boundaries are computed on the wall clock of the user's timezone and
+// only then converted back to an instant, so days and weeks start at local
+// midnight, DST transitions included.
+func (r *GoalRepository) FindAllWithProgress(userId string) ([]models.GoalProgress, error) {
+	query := `
+	SELECT g.*, p.period_start, p.period_end, a.achieved
+	FROM goals g
+	JOIN users u ON u.id = g.user_id
+	CROSS JOIN LATERAL (
+		SELECT date_trunc(g.period::text, now() AT TIME ZONE u.timezone) AS local_start
+	) l
+	CROSS JOIN LATERAL (
+		SELECT
+			l.local_start AT TIME ZONE u.timezone AS period_start,
+			(l.local_start + ('1 ' || g.period::text)::interval) AT TIME ZONE u.timezone AS period_end
+	) p
+	CROSS JOIN LATERAL (` + achievedQuery + `) a
+	WHERE g.user_id = @user_id
+	ORDER BY g.created_at
+	`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	goals, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.GoalProgress])
+	if err != nil {
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+// RecordCompletedPeriods stores the outcome of every period that ended since
+// the last recorded one, for all goals of the user. Periods are bounded the
+// same way as in FindAllWithProgress.
+func (r *GoalRepository) RecordCompletedPeriods(userId string) error {
+	query := `
+	INSERT INTO goal_periods (
+		goal_id,
+		period_start,
+		period_end,
+		target,
+		achieved,
+		completed
+	)
+	SELECT g.id, p.period_start, p.period_end, g.target, a.achieved, a.achieved >= g.target
+	FROM goals g
+	JOIN users u ON u.id = g.user_id
+	CROSS JOIN LATERAL (
+		SELECT date_trunc(
+			g.period::text,
+			COALESCE(MAX(period_end), g.created_at) AT TIME ZONE u.timezone
+		) AS local_start
+		FROM goal_periods
+		WHERE goal_id = g.id
+	) last
+	CROSS JOIN LATERAL (
+		SELECT
+			gs.local_start AT TIME ZONE u.timezone AS period_start,
+			(gs.local_start + ('1 ' || g.period::text)::interval) AT TIME ZONE u.timezone AS period_end
+		FROM generate_series(
+			last.local_start,
+			date_trunc(g.period::text, now() AT TIME ZONE u.timezone) - ('1 ' || g.period::text)::interval,
+			('1 ' || g.period::text)::interval
+		) AS gs(local_start)
+	) p
+	CROSS JOIN LATERAL (` + achievedQuery + `) a
+	WHERE g.user_id = @user_id
+	ON CONFLICT (goal_id, period_start) DO NOTHING
+	`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+func (r *GoalRepository) FindPeriodsByGoalId(goalId string, userId string) ([]models.GoalPeriod, error) {
+	query := `
+	SELECT gp.*
+	FROM goal_periods gp
+	JOIN goals g ON g.id = gp.goal_id
+	WHERE gp.goal_id = @goal_id AND g.user_id = @user_id
+	ORDER BY gp.period_start DESC
+	`
+	args := pgx.NamedArgs{
+		"goal_id": goalId,
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	periods, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.GoalPeriod])
+	if err != nil {
+		return nil, err
+	}
+
+	return periods, nil
+}
+
+func (r *GoalRepository) ExistsById(id string, userId string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM goals WHERE id = @id AND user_id = @user_id)`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+
+	var exists bool
+	if err := r.pgConn.QueryRow(r.ctx, query, args).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (r *GoalRepository) Delete(id string, userId string) error {
+	query := `DELETE FROM goals WHERE id = @id AND user_id = @user_id`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return models.NewError(http.StatusNotFound, "")
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package goal
+
+import (
+	"fit-byte/constants"
+	"fit-byte/models"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type GoalService struct {
+	goalRepository GoalRepository
+}
+
+func NewGoalService(goalRepository GoalRepository) GoalService {
+	return GoalService{goalRepository}
+}
+
+func (s *GoalService) CreateGoal(goal models.Goal) (*models.Goal, error) {
+	newGoal, err := s.goalRepository.Save(goal)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGoal, nil
+}
+
+func (s *GoalService) GetGoalsWithProgress(userId string) ([]models.GoalProgress, error) {
+	// Completed periods are recorded lazily, right before the user looks at
+	// their goals, so no background job is needed to keep history up to date.
+	if err := s.goalRepository.RecordCompletedPeriods(userId); err != nil {
+		return nil, err
+	}
+
+	goals, err := s.goalRepository.FindAllWithProgress(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+func (s *GoalService) GetGoalHistory(id string, userId string) ([]models.GoalPeriod, error) {
+	exists, err := s.goalRepository.ExistsById(id, userId)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return nil, models.NewError(http.StatusNotFound, "goalId is not found")
+		}
+
+		return nil, err
+	}
+	if !exists {
+		return nil, models.NewError(http.StatusNotFound, "goalId is not found")
+	}
+
+	if err := s.goalRepository.RecordCompletedPeriods(userId); err != nil {
+		return nil, err
+	}
+
+	periods, err := s.goalRepository.FindPeriodsByGoalId(id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return periods, nil
+}
+
+func (s *GoalService) DeleteGoal(id string, userId string) error {
+	err := s.goalRepository.Delete(id, userId)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return models.NewError(http.StatusNotFound, "")
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/units"
+	"fit-byte/utils"
+	"fit-byte/workout"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// The fields of an activity read from a CSV file.
+const (
+	csvFieldActivityType = "activityType"
+	csvFieldDoneAt       = "doneAt"
+	csvFieldDuration     = "duration"
+	csvFieldCalories     = "calories"
+	csvFieldDistance     = "distance"
+	csvFieldElevation    = "elevationGain"
+	csvFieldHeartRate    = "averageHeartRate"
+)
+
+// defaultCSVMapping reads the columns of the activity export.
+var defaultCSVMapping = map[string]string{
+	csvFieldActivityType: "activityType",
+	csvFieldDoneAt:       "doneAt",
+	csvFieldDuration:     "durationInMinutes",
+	csvFieldCalories:     "caloriesBurned",
+	csvFieldDistance:     "distanceInMeters",
+	csvFieldElevation:    "elevationGainInMeters",
+	csvFieldHeartRate:    "averageHeartRate",
+}
+
+var requiredCSVFields = []string{csvFieldActivityType, csvFieldDoneAt, csvFieldDuration}
+
+// csvTimeLayouts are the times understood without an offset, they are read
+// in the timezone of the import.
+var csvTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// CSVOptions tell how to read the activities of a CSV file.
+type CSVOptions struct {
+	// Mapping maps fields to the header of their column, fields left out are
+	// read from the columns of the activity export
+	Mapping map[string]string
+	// Location is where times without an offset were taken
+	Location     *time.Location
+	DurationUnit string
+	DistanceUnit string
+}
+
+// CSVRowError is why a row of a CSV file can't be imported. Rows are counted
+// from 1, the header being the first.
+type CSVRowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// csvRow is an activity read from a row of a CSV file.
+type csvRow struct {
+	row      int
+	activity models.Activity
+}
+
+// readActivitiesCSV reads the activities of a CSV file. Rows that can't be
+// read are returned as errors, the others are still read.
+func readActivitiesCSV(userId string, r io.Reader, options CSVOptions) ([]csvRow, []CSVRowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, models.NewError(http.StatusBadRequest, "The file has no header")
+	}
+
+	columnByHeader := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			// spreadsheets tend to start their exports with a BOM
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columnByHeader[strings.TrimSpace(name)] = i
+	}
+
+	columns := make(map[string]int, len(defaultCSVMapping))
+	for field, defaultName := range defaultCSVMapping {
+		name, mapped := options.Mapping[field]
+		if !mapped {
+			name = defaultName
+		}
+		if i, ok := columnByHeader[name]; ok {
+			columns[field] = i
+			continue
+		}
+		if mapped {
+			return nil, nil, models.NewError(http.StatusBadRequest, fmt.Sprintf("The column %q mapped to %s is missing", name, field))
+		}
+	}
+	for _, field := range requiredCSVFields {
+		if _, ok := columns[field]; !ok {
+			return nil, nil, models.NewError(http.StatusBadRequest, fmt.Sprintf("The file has no column for %s, map one", field))
+		}
+	}
+
+	rows := []csvRow{}
+	rowErrors := []CSVRowError{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, nil, err
+			}
+			rowErrors = append(rowErrors, CSVRowError{Row: parseErr.StartLine, Message: parseErr.Err.Error()})
+			continue
+		}
+		if len(rows)+len(rowErrors) >= constants.ACTIVITY_IMPORT_MAX_ROWS {
+			return nil, nil, models.NewError(http.StatusBadRequest, fmt.Sprintf("The file has more than %d rows", constants.ACTIVITY_IMPORT_MAX_ROWS))
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		value := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		activity, column, err := parseCSVActivity(value, options)
+		if err != nil {
+			rowErrors = append(rowErrors, CSVRowError{Row: line, Column: column, Message: err.Error()})
+			continue
+		}
+		activity.UserId = pgtype.Text{String: userId, Valid: true}
+		rows = append(rows, csvRow{row: line, activity: activity})
+	}
+
+	return rows, rowErrors, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseCSVActivity reads an activity from the values of a row, and tells the
+// field it failed on.
+func parseCSVActivity(value func(field string) string, options CSVOptions) (models.Activity, string, error) {
+	activity := models.Activity{}
+
+	activityType, err := parseCSVActivityType(value(csvFieldActivityType))
+	if err != nil {
+		return activity, csvFieldActivityType, err
+	}
+	activity.ActivityType = activityType
+
+	doneAt, err := parseCSVTime(value(csvFieldDoneAt), options.Location)
+	if err != nil {
+		return activity, csvFieldDoneAt, err
+	}
+	activity.DoneAt = doneAt
+
+	minutes, err := parseCSVDuration(value(csvFieldDuration), options.DurationUnit)
+	if err != nil {
+		return activity, csvFieldDuration, err
+	}
+	activity.DurationInMinutes = int(math.Round(minutes))
+	if activity.DurationInMinutes < 1 {
+		return activity, csvFieldDuration, errors.New("the activity must last at least a minute")
+	}
+
+	activity.CaloriesBurned = utils.CalculateCaloriesBurned(activity.ActivityType, activity.DurationInMinutes)
+	if raw := value(csvFieldCalories); raw != "" {
+		calories, err := strconv.ParseFloat(raw, 64)
+		if err != nil || calories < 0 {
+			return activity, csvFieldCalories, fmt.Errorf("%q is not a number of calories", raw)
+		}
+		if calories > 0 {
+			activity.CaloriesBurned = int(math.Round(calories))
+		}
+	}
+
+	if raw := value(csvFieldDistance); raw != "" {
+		distance, err := strconv.ParseFloat(raw, 64)
+		if err != nil || distance < 0 {
+			return activity, csvFieldDistance, fmt.Errorf("%q is not a distance", raw)
+		}
+		activity.DistanceInMeters = pgtype.Float8{Float64: units.ToMeters(distance, options.DistanceUnit), Valid: true}
+	}
+
+	// the elevation gain is in meters whatever the distance unit, like in the
+	// activity export
+	if raw := value(csvFieldElevation); raw != "" {
+		elevation, err := strconv.ParseFloat(raw, 64)
+		if err != nil || elevation < 0 {
+			return activity, csvFieldElevation, fmt.Errorf("%q is not an elevation gain", raw)
+		}
+		activity.ElevationGainInMeters = pgtype.Float8{Float64: elevation, Valid: true}
+	}
+
+	if raw := value(csvFieldHeartRate); raw != "" {
+		heartRate, err := strconv.ParseFloat(raw, 64)
+		if err != nil || heartRate <= 0 || heartRate > math.MaxInt32 {
+			return activity, csvFieldHeartRate, fmt.Errorf("%q is not a heart rate", raw)
+		}
+		activity.AverageHeartRate = pgtype.Int4{Int32: int32(math.Round(heartRate)), Valid: true}
+	}
+
+	return activity, "", nil
+}
+
+// parseCSVActivityType accepts the activity types, whatever their case, and
+// the sport names workout files use.
+func parseCSVActivityType(raw string) (string, error) {
+	if raw == "" {
+		return "", errors.New("the activity type is missing")
+	}
+	for _, activityType := range []string{"Walking", "Yoga", "Stretching", "Cycling", "Swimming", "Dancing", "Hiking", "Running", "HIIT", "JumpRope"} {
+		if strings.EqualFold(raw, activityType) {
+			return activityType, nil
+		}
+	}
+	if activityType, ok := workout.ActivityType(raw); ok {
+		return activityType, nil
+	}
+
+	return "", fmt.Errorf("%q is not an activity type", raw)
+}
+
+func parseCSVTime(raw string, location *time.Location) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, errors.New("the time is missing")
+	}
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t, nil
+	}
+	for _, layout := range csvTimeLayouts {
+		if t, err := time.ParseInLocation(layout, raw, location); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a time", raw)
+}
+
+// parseCSVDuration reads a duration in minutes, either a number in unit or a
+// clock duration like 1:05:30, or 45:00 for minutes and seconds.
+func parseCSVDuration(raw string, unit string) (float64, error) {
+	if raw == "" {
+		return 0, errors.New("the duration is missing")
+	}
+
+	if strings.Contains(raw, ":") {
+		parts := strings.Split(raw, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("%q is not a duration", raw)
+		}
+		seconds := 0.0
+		for _, part := range parts {
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("%q is not a duration", raw)
+			}
+			seconds = seconds*60 + n
+		}
+		return seconds / 60, nil
+	}
+
+	n, err := strconv.ParseFloat(raw, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a duration", raw)
+	}
+
+	return units.ToMinutes(n, unit), nil
+}
@@ -0,0 +1,416 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/units"
+	"fit-byte/workout"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errInvalidHistory is returned when the export itself can't be read, as
+// opposed to one of its records.
+var errInvalidHistory = errors.New("the export can't be read")
+
+// historyRecord is a workout or a body mass record of an export. err is set
+// when the record couldn't be read, the following ones still are.
+type historyRecord struct {
+	workout  *workout.Workout
+	bodyMass *historyBodyMass
+	err      error
+}
+
+type historyBodyMass struct {
+	measuredAt time.Time
+	weight     float64
+	// unit is units.KG or units.LBS
+	unit string
+}
+
+// countingFile counts the bytes read from the export, to report progress.
+type countingFile struct {
+	file *os.File
+	read *int64
+}
+
+func (f countingFile) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	*f.read += int64(n)
+	return n, err
+}
+
+func (f countingFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	*f.read += int64(n)
+	return n, err
+}
+
+// readHistory calls emit with every record of the export, always in the same
+// order so that an import can resume where it stopped. read counts the bytes
+// read so far. The errors of emit are returned as is.
+func readHistory(source string, file *os.File, size int64, read *int64, emit func(historyRecord) error) error {
+	counted := countingFile{file, read}
+
+	var archive *zip.Reader
+	magic := make([]byte, 4)
+	if _, err := file.ReadAt(magic, 0); err == nil && bytes.Equal(magic, []byte("PK\x03\x04")) {
+		var err error
+		if archive, err = zip.NewReader(counted, size); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidHistory, err)
+		}
+	}
+
+	switch source {
+	case constants.HISTORY_SOURCE_APPLE_HEALTH:
+		if archive == nil {
+			return readAppleHealth(counted, emit)
+		}
+		// the archive holds export.xml along with export_cda.xml and routes
+		for _, entry := range archive.File {
+			if path.Base(entry.Name) != "export.xml" {
+				continue
+			}
+			entryReader, err := entry.Open()
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidHistory, err)
+			}
+			defer entryReader.Close()
+			return readAppleHealth(entryReader, emit)
+		}
+		return fmt.Errorf("%w: the archive has no export.xml", errInvalidHistory)
+	case constants.HISTORY_SOURCE_GOOGLE_TAKEOUT:
+		if archive == nil {
+			return fmt.Errorf("%w: a Takeout archive is expected", errInvalidHistory)
+		}
+		return readGoogleTakeout(archive, emit)
+	}
+
+	return fmt.Errorf("%w: unknown source %s", errInvalidHistory, source)
+}
+
+// appleDateLayout is how dates are written in Apple Health exports.
+const appleDateLayout = "2006-01-02 15:04:05 -0700"
+
+type appleWorkout struct {
+	ActivityType          string `xml:"workoutActivityType,attr"`
+	Duration              string `xml:"duration,attr"`
+	DurationUnit          string `xml:"durationUnit,attr"`
+	TotalDistance         string `xml:"totalDistance,attr"`
+	TotalDistanceUnit     string `xml:"totalDistanceUnit,attr"`
+	TotalEnergyBurned     string `xml:"totalEnergyBurned,attr"`
+	TotalEnergyBurnedUnit string `xml:"totalEnergyBurnedUnit,attr"`
+	StartDate             string `xml:"startDate,attr"`
+	EndDate               string `xml:"endDate,attr"`
+	// recent exports moved the totals here
+	Statistics []struct {
+		Type    string `xml:"type,attr"`
+		Sum     string `xml:"sum,attr"`
+		Average string `xml:"average,attr"`
+		Unit    string `xml:"unit,attr"`
+	} `xml:"WorkoutStatistics"`
+}
+
+// readAppleHealth streams an export.xml, only workouts and body mass records
+// are decoded, the millions of other records are skipped.
+func readAppleHealth(r io.Reader, emit func(historyRecord) error) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidHistory, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "Workout":
+			var element appleWorkout
+			if err := decoder.DecodeElement(&element, &start); err != nil {
+				return fmt.Errorf("%w: %v", errInvalidHistory, err)
+			}
+			w, err := element.workout()
+			if err := emit(historyRecord{workout: w, err: err}); err != nil {
+				return err
+			}
+		case "Record":
+			isBodyMass := xmlAttr(start, "type") == "HKQuantityTypeIdentifierBodyMass"
+			if err := decoder.Skip(); err != nil {
+				return fmt.Errorf("%w: %v", errInvalidHistory, err)
+			}
+			if !isBodyMass {
+				continue
+			}
+			bodyMass, err := appleBodyMass(start)
+			if err := emit(historyRecord{bodyMass: bodyMass, err: err}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+func (e appleWorkout) workout() (*workout.Workout, error) {
+	startedAt, err := time.Parse(appleDateLayout, e.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid startDate %q", e.StartDate)
+	}
+	w := &workout.Workout{
+		Sport:     strings.TrimPrefix(e.ActivityType, "HKWorkoutActivityType"),
+		StartedAt: startedAt.UTC(),
+	}
+
+	if duration, err := strconv.ParseFloat(e.Duration, 64); err == nil {
+		switch e.DurationUnit {
+		case "s":
+			w.Duration = time.Duration(duration * float64(time.Second))
+		case "hr", "h":
+			w.Duration = time.Duration(duration * float64(time.Hour))
+		default:
+			w.Duration = time.Duration(duration * float64(time.Minute))
+		}
+	} else if endedAt, err := time.Parse(appleDateLayout, e.EndDate); err == nil {
+		w.Duration = endedAt.Sub(startedAt)
+	}
+	if w.Duration <= 0 {
+		return nil, errors.New("the workout has no duration")
+	}
+
+	if distance, err := strconv.ParseFloat(e.TotalDistance, 64); err == nil {
+		w.DistanceInMeters = toMeters(distance, e.TotalDistanceUnit)
+	}
+	if energy, err := strconv.ParseFloat(e.TotalEnergyBurned, 64); err == nil {
+		w.Calories = toKilocalories(energy, e.TotalEnergyBurnedUnit)
+	}
+	for _, statistic := range e.Statistics {
+		switch {
+		case strings.HasPrefix(statistic.Type, "HKQuantityTypeIdentifierDistance") && w.DistanceInMeters == 0:
+			if sum, err := strconv.ParseFloat(statistic.Sum, 64); err == nil {
+				w.DistanceInMeters = toMeters(sum, statistic.Unit)
+			}
+		case statistic.Type == "HKQuantityTypeIdentifierActiveEnergyBurned" && w.Calories == 0:
+			if sum, err := strconv.ParseFloat(statistic.Sum, 64); err == nil {
+				w.Calories = toKilocalories(sum, statistic.Unit)
+			}
+		case statistic.Type == "HKQuantityTypeIdentifierHeartRate":
+			if average, err := strconv.ParseFloat(statistic.Average, 64); err == nil {
+				w.AverageHeartRate = int(average + 0.5)
+			}
+		}
+	}
+
+	return w, nil
+}
+
+func appleBodyMass(element xml.StartElement) (*historyBodyMass, error) {
+	measuredAt, err := time.Parse(appleDateLayout, xmlAttr(element, "startDate"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid startDate %q", xmlAttr(element, "startDate"))
+	}
+	weight, err := strconv.ParseFloat(xmlAttr(element, "value"), 64)
+	if err != nil || weight <= 0 {
+		return nil, fmt.Errorf("invalid body mass %q", xmlAttr(element, "value"))
+	}
+
+	bodyMass := &historyBodyMass{measuredAt: measuredAt.UTC(), weight: weight}
+	switch xmlAttr(element, "unit") {
+	case "kg":
+		bodyMass.unit = units.KG
+	case "lb":
+		bodyMass.unit = units.LBS
+	case "g":
+		bodyMass.unit, bodyMass.weight = units.KG, weight/1000
+	default:
+		return nil, fmt.Errorf("unsupported body mass unit %q", xmlAttr(element, "unit"))
+	}
+
+	return bodyMass, nil
+}
+
+func toMeters(distance float64, unit string) float64 {
+	switch unit {
+	case "km":
+		return distance * 1000
+	case "mi":
+		return distance * 1609.344
+	case "yd":
+		return distance * 0.9144
+	case "ft":
+		return distance * 0.3048
+	}
+
+	return distance
+}
+
+func toKilocalories(energy float64, unit string) int {
+	if unit == "kJ" {
+		energy /= 4.184
+	}
+
+	return int(energy + 0.5)
+}
+
+type googleSession struct {
+	FitnessActivity string    `json:"fitnessActivity"`
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	// like "1800.000s"
+	Duration  string `json:"duration"`
+	Aggregate []struct {
+		MetricName string   `json:"metricName"`
+		FloatValue *float64 `json:"floatValue"`
+		IntValue   *int64   `json:"intValue"`
+	} `json:"aggregate"`
+}
+
+type googleDataPoint struct {
+	StartTimeNanos int64 `json:"startTimeNanos"`
+	FitValue       []struct {
+		Value struct {
+			FpVal *float64 `json:"fpVal"`
+		} `json:"value"`
+	} `json:"fitValue"`
+}
+
+// readGoogleTakeout reads the Google Fit sessions, one file each, and the
+// weight data points of a Takeout archive.
+func readGoogleTakeout(archive *zip.Reader, emit func(historyRecord) error) error {
+	for _, entry := range archive.File {
+		name := entry.Name
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		var err error
+		switch {
+		case strings.Contains(name, "Fit/All Sessions/"):
+			err = readGoogleSession(entry, emit)
+		case strings.Contains(name, "Fit/All Data/") && strings.Contains(path.Base(name), "com.google.weight"):
+			err = readGoogleWeights(entry, emit)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readGoogleSession(entry *zip.File, emit func(historyRecord) error) error {
+	entryReader, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidHistory, err)
+	}
+	defer entryReader.Close()
+
+	var session googleSession
+	if err := json.NewDecoder(entryReader).Decode(&session); err != nil {
+		return emit(historyRecord{err: fmt.Errorf("invalid session %s: %v", path.Base(entry.Name), err)})
+	}
+
+	return emit(historyRecord{workout: session.workout()})
+}
+
+func (s googleSession) workout() *workout.Workout {
+	w := &workout.Workout{Sport: s.FitnessActivity, StartedAt: s.StartTime.UTC()}
+	if seconds, err := strconv.ParseFloat(strings.TrimSuffix(s.Duration, "s"), 64); err == nil {
+		w.Duration = time.Duration(seconds * float64(time.Second))
+	} else {
+		w.Duration = s.EndTime.Sub(s.StartTime)
+	}
+	for _, aggregate := range s.Aggregate {
+		if aggregate.FloatValue == nil {
+			continue
+		}
+		switch aggregate.MetricName {
+		case "com.google.calories.expended":
+			w.Calories = int(*aggregate.FloatValue + 0.5)
+		case "com.google.distance.delta":
+			w.DistanceInMeters = *aggregate.FloatValue
+		}
+	}
+
+	return w
+}
+
+// readGoogleWeights streams the "Data Points" of a weight file, in
+// kilograms.
+func readGoogleWeights(entry *zip.File, emit func(historyRecord) error) error {
+	entryReader, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidHistory, err)
+	}
+	defer entryReader.Close()
+
+	decoder := json.NewDecoder(entryReader)
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidHistory, err)
+		}
+		if delim, ok := token.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+			continue
+		}
+		if key, ok := token.(string); !ok || depth != 1 || key != "Data Points" {
+			continue
+		}
+
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return fmt.Errorf("%w: invalid data points in %s", errInvalidHistory, path.Base(entry.Name))
+		}
+		for decoder.More() {
+			var point googleDataPoint
+			if err := decoder.Decode(&point); err != nil {
+				return fmt.Errorf("%w: %v", errInvalidHistory, err)
+			}
+			if err := emit(point.bodyMass()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (p googleDataPoint) bodyMass() historyRecord {
+	if len(p.FitValue) == 0 || p.FitValue[0].Value.FpVal == nil || *p.FitValue[0].Value.FpVal <= 0 {
+		return historyRecord{err: errors.New("the data point has no weight")}
+	}
+
+	return historyRecord{bodyMass: &historyBodyMass{
+		measuredAt: time.Unix(0, p.StartTimeNanos).UTC(),
+		weight:     *p.FitValue[0].Value.FpVal,
+		unit:       units.KG,
+	}}
+}
@@ -0,0 +1,323 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/types"
+	"fit-byte/units"
+	"fit-byte/usecases/activity"
+	"fit-byte/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type ImporterHandler struct {
+	importerService ImporterService
+}
+
+var (
+	maxWorkoutFileSize = int64(20 * 1024 * 1024)       // 20MB
+	maxCSVFileSize     = int64(10 * 1024 * 1024)       // 10MB
+	maxHistoryFileSize = int64(2 * 1024 * 1024 * 1024) // 2GB
+)
+
+func NewImporterHandler(importerService ImporterService) ImporterHandler {
+	return ImporterHandler{importerService}
+}
+
+func (h *ImporterHandler) HandleImportWorkout(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxWorkoutFileSize)
+	if err := r.ParseMultipartForm(maxWorkoutFileSize); err != nil {
+		return models.NewError(http.StatusBadRequest, "File is too large")
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		return models.NewError(http.StatusBadRequest, "Invalid file")
+	}
+	defer file.Close()
+
+	activityType := r.FormValue("activityType")
+	validate := validator.New()
+	if err := validate.Var(activityType, "omitempty,oneof=Walking Yoga Stretching Cycling Swimming Dancing Hiking Running HIIT JumpRope"); err != nil {
+		return models.NewError(http.StatusBadRequest, "validation for 'activityType' failed")
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	results, err := h.importerService.ImportWorkout(userId, fileHeader.Filename, file, activityType)
+	if err != nil {
+		return err
+	}
+
+	// the sessions overlapping an activity are skipped, the file is only
+	// rejected when all of them are
+	res := make([]activity.ActivityResponse, 0, len(results))
+	var skipErr error
+	for _, result := range results {
+		if result.Err != nil {
+			skipErr = result.Err
+			continue
+		}
+		res = append(res, activity.NewActivityResponse(*result.Activity))
+	}
+	if len(res) == 0 {
+		return skipErr
+	}
+	if skipErr == nil {
+		utils.SetJsonResponse(w, http.StatusCreated, res)
+		return nil
+	}
+
+	items := make([]activity.BatchItemResponse, len(results))
+	for i, result := range results {
+		items[i] = activity.NewBatchItemResponse(i, http.StatusCreated, result.Activity, result.Err)
+	}
+	utils.SetJsonResponse(w, http.StatusMultiStatus, items)
+
+	return nil
+}
+
+type csvImportActivity struct {
+	Row                   int              `json:"row"`
+	ActivityId            string           `json:"activityId,omitempty"`
+	ActivityType          string           `json:"activityType"`
+	DoneAt                types.CustomTime `json:"doneAt"`
+	DurationInMinutes     int              `json:"durationInMinutes"`
+	CaloriesBurned        int              `json:"caloriesBurned"`
+	DistanceInMeters      pgtype.Float8    `json:"distanceInMeters"`
+	ElevationGainInMeters pgtype.Float8    `json:"elevationGainInMeters"`
+	AverageHeartRate      pgtype.Int4      `json:"averageHeartRate"`
+}
+
+type CSVImportResponse struct {
+	DryRun     bool                `json:"dryRun"`
+	Imported   int                 `json:"imported"`
+	Activities []csvImportActivity `json:"activities"`
+	Errors     []CSVRowError       `json:"errors"`
+}
+
+// HandleImportActivitiesCSV imports the activities of a CSV file, by default
+// one laid out like the activity export. mapping, a JSON object, names the
+// columns of the fields, times without an offset are read in timezone and
+// durations and distances in durationUnit and distanceUnit, elevation gains
+// being in meters. In ATOMIC mode, the default, nothing is imported unless
+// every row is valid. With dryRun the activities are only previewed.
+func (h *ImporterHandler) HandleImportActivitiesCSV(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCSVFileSize)
+	if err := r.ParseMultipartForm(maxCSVFileSize); err != nil {
+		return models.NewError(http.StatusBadRequest, "File is too large")
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return models.NewError(http.StatusBadRequest, "Invalid file")
+	}
+	defer file.Close()
+
+	options := CSVOptions{
+		Location:     time.UTC,
+		DurationUnit: units.MINUTES,
+		DistanceUnit: units.M,
+	}
+	if mapping := r.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &options.Mapping); err != nil {
+			return models.NewError(http.StatusBadRequest, "validation for 'mapping' failed")
+		}
+		for field := range options.Mapping {
+			if _, ok := defaultCSVMapping[field]; !ok {
+				return models.NewError(http.StatusBadRequest, fmt.Sprintf("%s is not a field, map activityType, doneAt, duration, calories or distance", field))
+			}
+		}
+	}
+	if timezone := r.FormValue("timezone"); timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return models.NewError(http.StatusBadRequest, "validation for 'timezone' failed")
+		}
+		options.Location = location
+	}
+	validate := validator.New()
+	if durationUnit := r.FormValue("durationUnit"); durationUnit != "" {
+		if err := validate.Var(durationUnit, "oneof=SECONDS MINUTES HOURS"); err != nil {
+			return models.NewError(http.StatusBadRequest, "validation for 'durationUnit' failed")
+		}
+		options.DurationUnit = durationUnit
+	}
+	if distanceUnit := r.FormValue("distanceUnit"); distanceUnit != "" {
+		if err := validate.Var(distanceUnit, "oneof=M KM MI"); err != nil {
+			return models.NewError(http.StatusBadRequest, "validation for 'distanceUnit' failed")
+		}
+		options.DistanceUnit = distanceUnit
+	}
+	mode := r.FormValue("mode")
+	if err := validate.Var(mode, "omitempty,oneof=ATOMIC PARTIAL"); err != nil {
+		return models.NewError(http.StatusBadRequest, "validation for 'mode' failed")
+	}
+	dryRun := false
+	if dryRunRaw := r.FormValue("dryRun"); dryRunRaw != "" {
+		if dryRun, err = strconv.ParseBool(dryRunRaw); err != nil {
+			return models.NewError(http.StatusBadRequest, "validation for 'dryRun' failed")
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	result, err := h.importerService.ImportActivitiesCSV(userId, file, options, dryRun, mode == constants.BATCH_MODE_PARTIAL)
+	if err != nil {
+		return err
+	}
+
+	res := CSVImportResponse{
+		DryRun:     dryRun,
+		Activities: make([]csvImportActivity, 0, len(result.Activities)),
+		Errors:     result.Errors,
+	}
+	for i, activity := range result.Activities {
+		res.Activities = append(res.Activities, csvImportActivity{
+			Row:                   result.Rows[i],
+			ActivityId:            activity.Id,
+			ActivityType:          activity.ActivityType,
+			DoneAt:                types.CustomTime(activity.DoneAt),
+			DurationInMinutes:     activity.DurationInMinutes,
+			CaloriesBurned:        activity.CaloriesBurned,
+			DistanceInMeters:      activity.DistanceInMeters,
+			ElevationGainInMeters: activity.ElevationGainInMeters,
+			AverageHeartRate:      activity.AverageHeartRate,
+		})
+	}
+	if result.Imported {
+		res.Imported = len(result.Activities)
+	}
+
+	switch {
+	case dryRun:
+		utils.SetJsonResponse(w, http.StatusOK, res)
+	case !result.Imported:
+		utils.SetJsonResponse(w, http.StatusBadRequest, res)
+	case len(result.Errors) > 0:
+		utils.SetJsonResponse(w, http.StatusMultiStatus, res)
+	default:
+		utils.SetJsonResponse(w, http.StatusCreated, res)
+	}
+
+	return nil
+}
+
+// HandleRequestHistoryImport queues the import of an Apple Health export, the
+// export.xml or the archive it comes in, or of a Google Takeout archive. The
+// file is streamed to disk, exports weigh hundreds of megabytes.
+func (h *ImporterHandler) HandleRequestHistoryImport(w http.ResponseWriter, r *http.Request) error {
+	source := r.URL.Query().Get("source")
+	validate := validator.New()
+	if err := validate.Var(source, "required,oneof=APPLE_HEALTH GOOGLE_TAKEOUT"); err != nil {
+		return models.NewError(http.StatusBadRequest, "validation for 'source' failed")
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxHistoryFileSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return models.NewError(http.StatusBadRequest, "Invalid file")
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return models.NewError(http.StatusBadRequest, "Invalid file")
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		spooled, err := os.CreateTemp("", "fit-byte-upload-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spooled.Name())
+		defer spooled.Close()
+
+		size, err := io.Copy(spooled, part)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return models.NewError(http.StatusBadRequest, "File is too large")
+			}
+			return models.NewError(http.StatusBadRequest, "Invalid file")
+		}
+		if _, err := spooled.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		_, claims, err := jwtauth.FromContext(r.Context())
+		if err != nil {
+			return models.NewError(http.StatusInternalServerError, err.Error())
+		}
+		userId := claims["userId"].(string)
+
+		historyImport, err := h.importerService.RequestHistoryImport(userId, source, spooled, size)
+		if err != nil {
+			return err
+		}
+		utils.SetJsonResponse(w, http.StatusAccepted, historyImport)
+
+		return nil
+	}
+}
+
+func (h *ImporterHandler) HandleGetHistoryImports(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	historyImports, err := h.importerService.GetHistoryImports(userId)
+	if err != nil {
+		return err
+	}
+	utils.SetJsonResponse(w, http.StatusOK, historyImports)
+
+	return nil
+}
+
+func (h *ImporterHandler) HandleGetHistoryImport(w http.ResponseWriter, r *http.Request) error {
+	importId := r.PathValue("importId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	historyImport, importErrors, err := h.importerService.GetHistoryImport(importId, userId)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		*models.HistoryImport
+		Errors []models.HistoryImportError `json:"errors"`
+	}{
+		HistoryImport: historyImport,
+		Errors:        importErrors,
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package importer
+
+import (
+	"context"
+	"fit-byte/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ImporterRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewImporterRepository(ctx context.Context, pgConn *pgxpool.Pool) ImporterRepository {
+	return ImporterRepository{ctx, pgConn}
+}
+
+// SaveHistoryImport queues an import, unless the user already has one queued
+// or running.
+func (r *ImporterRepository) SaveHistoryImport(historyImport models.HistoryImport) (*models.HistoryImport, error) {
+	query := `
+	INSERT INTO history_imports (user_id, source, file_key, total_bytes)
+	SELECT @user_id, @source, @file_key, @total_bytes
+	WHERE NOT EXISTS (
+		SELECT 1 FROM history_imports
+		WHERE user_id = @user_id AND status IN ('PENDING', 'RUNNING')
+	)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"user_id":     historyImport.UserId,
+		"source":      historyImport.Source,
+		"file_key":    historyImport.FileKey,
+		"total_bytes": historyImport.TotalBytes,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	newImport, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.HistoryImport])
+	if err != nil {
+		return nil, err
+	}
+
+	return &newImport, nil
+}
+
+func (r *ImporterRepository) FindHistoryImports(userId string) ([]models.HistoryImport, error) {
+	query := `SELECT * FROM history_imports WHERE user_id = @user_id ORDER BY created_at DESC`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.HistoryImport])
+}
+
+func (r *ImporterRepository) FindHistoryImport(id string, userId string) (*models.HistoryImport, error) {
+	query := `SELECT * FROM history_imports WHERE id = @id AND user_id = @user_id`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	historyImport, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.HistoryImport])
+	if err != nil {
+		return nil, err
+	}
+
+	return &historyImport, nil
+}
+
+func (r *ImporterRepository) FindHistoryImportErrors(importId string) ([]models.HistoryImportError, error) {
+	query := `SELECT * FROM history_import_errors WHERE import_id = @import_id ORDER BY record_index`
+	args := pgx.NamedArgs{
+		"import_id": importId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.HistoryImportError])
+}
+
+// ClaimHistoryImport marks the oldest queued import as running and returns
+// it, or returns pgx.ErrNoRows when there is none. Imports whose heartbeat
+// stopped for longer than staleAfter, their instance having died, are claimed
+// again.
+func (r *ImporterRepository) ClaimHistoryImport(staleAfter time.Duration) (*models.HistoryImport, error) {
+	query := `
+	UPDATE history_imports
+	SET status = 'RUNNING',
+		started_at = COALESCE(started_at, CURRENT_TIMESTAMP),
+		heartbeat_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id FROM history_imports
+		WHERE status = 'PENDING'
+			OR (status = 'RUNNING' AND heartbeat_at < CURRENT_TIMESTAMP - @stale_after::interval)
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"stale_after": staleAfter,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	historyImport, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.HistoryImport])
+	if err != nil {
+		return nil, err
+	}
+
+	return &historyImport, nil
+}
+
+// Heartbeat tells the import is still being worked on.
+func (r *ImporterRepository) Heartbeat(id string) error {
+	query := `UPDATE history_imports SET heartbeat_at = CURRENT_TIMESTAMP WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+// SaveProgress stores the counts of the import along with the errors of the
+// records processed since the last checkpoint.
+func (r *ImporterRepository) SaveProgress(historyImport *models.HistoryImport, errors []models.HistoryImportError) error {
+	return pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(r.ctx, `
+		UPDATE history_imports
+		SET processed_bytes = @processed_bytes,
+			processed_records = @processed_records,
+			imported_activities = @imported_activities,
+			imported_measurements = @imported_measurements,
+			skipped_records = @skipped_records,
+			failed_records = @failed_records,
+			heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = @id
+		`, pgx.NamedArgs{
+			"id":                    historyImport.Id,
+			"processed_bytes":       historyImport.ProcessedBytes,
+			"processed_records":     historyImport.ProcessedRecords,
+			"imported_activities":   historyImport.ImportedActivities,
+			"imported_measurements": historyImport.ImportedMeasurements,
+			"skipped_records":       historyImport.SkippedRecords,
+			"failed_records":        historyImport.FailedRecords,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, importError := range errors {
+			_, err := tx.Exec(r.ctx, `
+			INSERT INTO history_import_errors (import_id, record_index, message)
+			VALUES (@import_id, @record_index, @message)
+			ON CONFLICT (import_id, record_index) DO NOTHING
+			`, pgx.NamedArgs{
+				"import_id":    historyImport.Id,
+				"record_index": importError.RecordIndex,
+				"message":      importError.Message,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *ImporterRepository) CompleteHistoryImport(id string) error {
+	query := `
+	UPDATE history_imports
+	SET status = 'DONE', processed_bytes = total_bytes, completed_at = CURRENT_TIMESTAMP
+	WHERE id = @id
+	`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+func (r *ImporterRepository) FailHistoryImport(id string, message string) error {
+	query := `
+	UPDATE history_imports
+	SET status = 'FAILED', error = @error, completed_at = CURRENT_TIMESTAMP
+	WHERE id = @id
+	`
+	args := pgx.NamedArgs{
+		"id":    id,
+		"error": message,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
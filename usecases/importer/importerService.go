@@ -0,0 +1,399 @@
+package importer
+
+import (
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/units"
+	"fit-byte/usecases/activity"
+	"fit-byte/usecases/file"
+	"fit-byte/usecases/measurement"
+	"fit-byte/workout"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// historyImportStaleAfter is how long an import may go without a heartbeat
+// before it is assumed its instance died, and it is resumed.
+const historyImportStaleAfter = 5 * time.Minute
+
+// historyImportCheckpoint is how many records are processed between two
+// checkpoints.
+const historyImportCheckpoint = 100
+
+type ImporterService struct {
+	importerRepository ImporterRepository
+	activityService    activity.ActivityService
+	measurementService measurement.MeasurementService
+	fileService        file.FileService
+}
+
+func NewImporterService(importerRepository ImporterRepository, activityService activity.ActivityService, measurementService measurement.MeasurementService, fileService file.FileService) ImporterService {
+	return ImporterService{importerRepository, activityService, measurementService, fileService}
+}
+
+// ImportWorkout creates the activities of a workout file, one per session
+// for multisport FIT files, and returns a result for each of them.
+// activityType, when given, is used instead of the one told by the file.
+func (s *ImporterService) ImportWorkout(userId string, fileName string, file io.Reader, activityType string) ([]activity.BatchResult, error) {
+	workouts, err := workout.Parse(fileName, file)
+	if err != nil {
+		if errors.Is(err, workout.ErrUnsupportedFormat) {
+			return nil, models.NewError(http.StatusBadRequest, "Only gpx, tcx and fit files are allowed")
+		}
+
+		return nil, models.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	recorded := make([]activity.RecordedActivity, 0, len(workouts))
+	for _, w := range workouts {
+		item, err := newRecordedActivity(userId, w, activityType)
+		if err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, item)
+	}
+
+	return s.activityService.ImportActivities(recorded)
+}
+
+// CSVImport is the outcome of a CSV import. Activities are the ones created,
+// or on a dry run the ones that would be, along with the row they were read
+// from.
+type CSVImport struct {
+	Activities []models.Activity
+	Rows       []int
+	Errors     []CSVRowError
+	// Imported is false on a dry run, and when the rows that failed rolled
+	// back the whole import
+	Imported bool
+}
+
+// ImportActivitiesCSV creates the activities of a CSV file. Rows overlapping
+// an activity of the user's fail, like importing the same file twice would,
+// and so do rows overlapping an earlier row. Unless partial, no activity is
+// created when any row fails. A dry run only reads the file.
+func (s *ImporterService) ImportActivitiesCSV(userId string, file io.Reader, options CSVOptions, dryRun bool, partial bool) (*CSVImport, error) {
+	rows, rowErrors, err := readActivitiesCSV(userId, file, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 && len(rowErrors) == 0 {
+		return nil, models.NewError(http.StatusBadRequest, "The file has no activities")
+	}
+
+	result := &CSVImport{Errors: rowErrors}
+	activities := make([]models.Activity, 0, len(rows))
+	for _, row := range rows {
+		existing, err := s.activityService.FindOverlapping(row.activity)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			result.Errors = append(result.Errors, CSVRowError{
+				Row:     row.row,
+				Column:  csvFieldDoneAt,
+				Message: fmt.Sprintf("the activity overlaps activity %s", existing.Id),
+			})
+			continue
+		}
+		if i := slices.IndexFunc(activities, func(other models.Activity) bool { return activity.Overlaps(row.activity, other) }); i >= 0 {
+			result.Errors = append(result.Errors, CSVRowError{
+				Row:     row.row,
+				Column:  csvFieldDoneAt,
+				Message: fmt.Sprintf("the activity overlaps the one of row %d", result.Rows[i]),
+			})
+			continue
+		}
+		activities = append(activities, row.activity)
+		result.Rows = append(result.Rows, row.row)
+	}
+	slices.SortFunc(result.Errors, func(a, b CSVRowError) int {
+		return a.Row - b.Row
+	})
+
+	result.Activities = activities
+	if dryRun || len(activities) == 0 || (len(result.Errors) > 0 && !partial) {
+		return result, nil
+	}
+
+	result.Activities, err = s.activityService.CreateActivities(activities)
+	if err != nil {
+		return nil, err
+	}
+	result.Imported = true
+
+	return result, nil
+}
+
+// newRecordedActivity turns a workout into an activity of the user's, dated
+// when the workout started.
+func newRecordedActivity(userId string, w *workout.Workout, activityType string) (activity.RecordedActivity, error) {
+	if activityType == "" {
+		var ok bool
+		activityType, ok = workout.ActivityType(w.Sport)
+		if !ok {
+			return activity.RecordedActivity{}, models.NewError(http.StatusBadRequest, "The activity type can't be told from the file, send activityType along")
+		}
+	}
+
+	durationInMinutes := int(math.Round(w.Duration.Minutes()))
+	if durationInMinutes < 1 {
+		durationInMinutes = 1
+	}
+
+	newActivity := models.Activity{
+		ActivityType:      activityType,
+		DoneAt:            w.StartedAt,
+		DurationInMinutes: durationInMinutes,
+		CaloriesBurned:    w.Calories,
+		UserId:            pgtype.Text{String: userId, Valid: true},
+	}
+	if w.DistanceInMeters > 0 {
+		newActivity.DistanceInMeters = pgtype.Float8{Float64: math.Round(w.DistanceInMeters*10) / 10, Valid: true}
+	}
+	if w.ElevationGainInMeters > 0 {
+		newActivity.ElevationGainInMeters = pgtype.Float8{Float64: math.Round(w.ElevationGainInMeters*10) / 10, Valid: true}
+	}
+	if w.AverageHeartRate > 0 {
+		newActivity.AverageHeartRate = pgtype.Int4{Int32: int32(w.AverageHeartRate), Valid: true}
+	}
+
+	points := make([]models.TrackPoint, 0, len(w.Points))
+	for _, point := range w.Points {
+		trackPoint := models.TrackPoint{RecordedAt: point.Time}
+		if point.Latitude != nil && point.Longitude != nil {
+			trackPoint.Latitude = pgtype.Float8{Float64: *point.Latitude, Valid: true}
+			trackPoint.Longitude = pgtype.Float8{Float64: *point.Longitude, Valid: true}
+		}
+		if point.Elevation != nil {
+			trackPoint.Elevation = pgtype.Float8{Float64: *point.Elevation, Valid: true}
+		}
+		if point.HeartRate != nil {
+			trackPoint.HeartRate = pgtype.Int4{Int32: int32(*point.HeartRate), Valid: true}
+		}
+		if point.Power != nil {
+			trackPoint.Power = pgtype.Int4{Int32: int32(*point.Power), Valid: true}
+		}
+		points = append(points, trackPoint)
+	}
+
+	return activity.RecordedActivity{Activity: newActivity, Track: points}, nil
+}
+
+// RequestHistoryImport stores the export, size bytes long, and queues its
+// import. It fails with 409 when an import of the user's is already in
+// progress.
+func (s *ImporterService) RequestHistoryImport(userId string, source string, file io.Reader, size int64) (*models.HistoryImport, error) {
+	fileKey := fmt.Sprintf("imports/%s/%d", userId, time.Now().UnixNano())
+	if err := s.fileService.PutPrivateObject(fileKey, file, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	historyImport, err := s.importerRepository.SaveHistoryImport(models.HistoryImport{
+		UserId:     userId,
+		Source:     source,
+		FileKey:    fileKey,
+		TotalBytes: size,
+	})
+	if err != nil {
+		if err := s.fileService.DeleteObjects([]string{fileKey}); err != nil {
+			log.Printf("Error deleting history export %s: %v", fileKey, err)
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NewError(http.StatusConflict, "An import is already in progress")
+		}
+
+		return nil, err
+	}
+
+	return historyImport, nil
+}
+
+func (s *ImporterService) GetHistoryImports(userId string) ([]models.HistoryImport, error) {
+	return s.importerRepository.FindHistoryImports(userId)
+}
+
+// GetHistoryImport returns the import along with the errors of the records
+// that couldn't be imported.
+func (s *ImporterService) GetHistoryImport(id string, userId string) (*models.HistoryImport, []models.HistoryImportError, error) {
+	historyImport, err := s.importerRepository.FindHistoryImport(id, userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, models.NewError(http.StatusNotFound, "")
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return nil, nil, models.NewError(http.StatusNotFound, "")
+		}
+
+		return nil, nil, err
+	}
+
+	importErrors, err := s.importerRepository.FindHistoryImportErrors(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return historyImport, importErrors, nil
+}
+
+// ProcessHistoryImports runs the queued imports one after the other. An
+// import that stops on an error other than an unreadable export is left
+// running, it resumes from its last checkpoint once it is stale.
+func (s *ImporterService) ProcessHistoryImports() error {
+	for {
+		historyImport, err := s.importerRepository.ClaimHistoryImport(historyImportStaleAfter)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+
+			return err
+		}
+
+		err = s.runHistoryImport(historyImport)
+		if errors.Is(err, errInvalidHistory) {
+			if err := s.importerRepository.FailHistoryImport(historyImport.Id, err.Error()); err != nil {
+				return err
+			}
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("import %s: %w", historyImport.Id, err)
+		}
+		if err := s.fileService.DeleteObjects([]string{historyImport.FileKey}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ImporterService) runHistoryImport(historyImport *models.HistoryImport) error {
+	// the export is spooled to disk, archives can't be read as a stream
+	object, err := s.fileService.GetObject(historyImport.FileKey)
+	if err != nil {
+		return err
+	}
+	spooled, err := os.CreateTemp("", "fit-byte-history-*")
+	if err != nil {
+		object.Close()
+		return err
+	}
+	defer os.Remove(spooled.Name())
+	defer spooled.Close()
+	size, err := io.Copy(spooled, object)
+	object.Close()
+	if err != nil {
+		return err
+	}
+	if _, err := spooled.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(historyImportStaleAfter / 5)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := s.importerRepository.Heartbeat(historyImport.Id); err != nil {
+					log.Printf("Error sending heartbeat of import %s: %v", historyImport.Id, err)
+				}
+			}
+		}
+	}()
+
+	progress := *historyImport
+	progress.ProcessedBytes = 0
+	var pendingErrors []models.HistoryImportError
+	index := 0
+	err = readHistory(historyImport.Source, spooled, size, &progress.ProcessedBytes, func(record historyRecord) error {
+		recordIndex := index
+		index++
+		// records before the checkpoint were handled by a previous run
+		if recordIndex < historyImport.ProcessedRecords {
+			return nil
+		}
+
+		isActivity, err := s.importRecord(historyImport.UserId, record)
+		var appErr *models.AppError
+		switch {
+		case err == nil && isActivity:
+			progress.ImportedActivities++
+		case err == nil:
+			progress.ImportedMeasurements++
+		case errors.As(err, &appErr) && appErr.Code == http.StatusConflict:
+			progress.SkippedRecords++
+		case errors.As(err, &appErr):
+			progress.FailedRecords++
+			if progress.FailedRecords <= constants.HISTORY_IMPORT_MAX_ERRORS {
+				pendingErrors = append(pendingErrors, models.HistoryImportError{RecordIndex: recordIndex, Message: appErr.Message})
+			}
+		default:
+			return err
+		}
+		progress.ProcessedRecords = index
+
+		if index%historyImportCheckpoint == 0 {
+			if err := s.importerRepository.SaveProgress(&progress, pendingErrors); err != nil {
+				return err
+			}
+			pendingErrors = nil
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.importerRepository.SaveProgress(&progress, pendingErrors); err != nil {
+		return err
+	}
+
+	return s.importerRepository.CompleteHistoryImport(historyImport.Id)
+}
+
+// importRecord imports a record and tells whether it became an activity or a
+// measurement. It returns a *models.AppError when the record itself can't be
+// imported, 409 when it already was, by a previous run or by hand, and other
+// errors when the import can't go on.
+func (s *ImporterService) importRecord(userId string, record historyRecord) (bool, error) {
+	if record.err != nil {
+		return false, models.NewError(http.StatusUnprocessableEntity, record.err.Error())
+	}
+
+	if record.workout != nil {
+		recorded, err := newRecordedActivity(userId, record.workout, "")
+		if err != nil {
+			return false, err
+		}
+		results, err := s.activityService.ImportActivities([]activity.RecordedActivity{recorded})
+		if err != nil {
+			return true, err
+		}
+
+		return true, results[0].Err
+	}
+
+	_, err := s.measurementService.ImportMeasurement(models.BodyMeasurement{
+		UserId:     userId,
+		MeasuredAt: record.bodyMass.measuredAt,
+		Weight:     pgtype.Float8{Float64: record.bodyMass.weight, Valid: true},
+	}, units.Preferences{Weight: record.bodyMass.unit, Height: units.CM})
+
+	return false, err
+}
@@ -0,0 +1,261 @@
+package measurement
+
+import (
+	"encoding/json"
+	"fit-byte/models"
+	"fit-byte/types"
+	"fit-byte/units"
+	"fit-byte/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type MeasurementHandler struct {
+	measurementService MeasurementService
+}
+
+func NewMeasurementHandler(measurementService MeasurementService) MeasurementHandler {
+	return MeasurementHandler{measurementService}
+}
+
+type measurementResponse struct {
+	MeasurementId     string           `json:"measurementId"`
+	MeasuredAt        types.CustomTime `json:"measuredAt"`
+	Weight            pgtype.Float8    `json:"weight"`
+	BodyFatPercentage pgtype.Float8    `json:"bodyFatPercentage"`
+	Waist             pgtype.Float8    `json:"waist"`
+	RestingHeartRate  pgtype.Int4      `json:"restingHeartRate"`
+	CreatedAt         types.CustomTime `json:"createdAt"`
+}
+
+func newMeasurementResponse(measurement models.BodyMeasurement, prefs units.Preferences) measurementResponse {
+	res := measurementResponse{
+		MeasurementId:     measurement.Id,
+		MeasuredAt:        types.CustomTime(measurement.MeasuredAt),
+		Weight:            measurement.Weight,
+		BodyFatPercentage: measurement.BodyFatPercentage,
+		Waist:             measurement.Waist,
+		RestingHeartRate:  measurement.RestingHeartRate,
+		CreatedAt:         types.CustomTime(measurement.CreatedAt),
+	}
+	if res.Weight.Valid {
+		res.Weight.Float64 = units.FromKg(res.Weight.Float64, prefs.Weight)
+	}
+	if res.Waist.Valid {
+		res.Waist.Float64 = units.FromCm(res.Waist.Float64, prefs.Height)
+	}
+
+	return res
+}
+
+// requestUnits are the units the request body and the response are expressed
+// in: the user's preferences, overridden by an Accept-Units header.
+func (h *MeasurementHandler) requestUnits(w http.ResponseWriter, r *http.Request, userId string) (units.Preferences, error) {
+	prefs, err := h.measurementService.GetPreferredUnits(userId)
+	if err != nil {
+		return prefs, err
+	}
+	prefs = units.ParseAcceptUnits(r.Header.Get("Accept-Units"), prefs)
+	w.Header().Set("Content-Units", prefs.String())
+
+	return prefs, nil
+}
+
+func parseTimeParam(params url.Values, name string) (*time.Time, error) {
+	value := params.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, models.NewError(http.StatusBadRequest, fmt.Sprintf("%s must be an ISO 8601 date", name))
+	}
+
+	return &t, nil
+}
+
+func (h *MeasurementHandler) HandleCreateMeasurement(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		MeasuredAt        *time.Time `json:"measuredAt"`
+		Weight            *float64   `json:"weight" validate:"omitempty,gte=10,lte=1000"`
+		BodyFatPercentage *float64   `json:"bodyFatPercentage" validate:"omitempty,gt=0,lt=100"`
+		Waist             *float64   `json:"waist" validate:"omitempty,gte=10,lte=500"`
+		RestingHeartRate  *int       `json:"restingHeartRate" validate:"omitempty,gte=20,lte=250"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+	if payload.Weight == nil && payload.BodyFatPercentage == nil && payload.Waist == nil && payload.RestingHeartRate == nil {
+		return models.NewError(http.StatusBadRequest, "at least one measurement is required")
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+	prefs, err := h.requestUnits(w, r, userId)
+	if err != nil {
+		return err
+	}
+
+	measurement := models.BodyMeasurement{
+		UserId:     userId,
+		MeasuredAt: time.Now(),
+	}
+	if payload.MeasuredAt != nil {
+		measurement.MeasuredAt = *payload.MeasuredAt
+	}
+	if payload.Weight != nil {
+		measurement.Weight = pgtype.Float8{Float64: *payload.Weight, Valid: true}
+	}
+	if payload.BodyFatPercentage != nil {
+		measurement.BodyFatPercentage = pgtype.Float8{Float64: *payload.BodyFatPercentage, Valid: true}
+	}
+	if payload.Waist != nil {
+		measurement.Waist = pgtype.Float8{Float64: *payload.Waist, Valid: true}
+	}
+	if payload.RestingHeartRate != nil {
+		measurement.RestingHeartRate = pgtype.Int4{Int32: int32(*payload.RestingHeartRate), Valid: true}
+	}
+
+	newMeasurement, err := h.measurementService.CreateMeasurement(measurement, prefs)
+	if err != nil {
+		return err
+	}
+
+	utils.SetJsonResponse(w, http.StatusCreated, newMeasurementResponse(*newMeasurement, prefs))
+
+	return nil
+}
+
+// HandleGetMeasurements lists the measurements taken between from and to, or
+// their daily or weekly averages when bucket is set.
+func (h *MeasurementHandler) HandleGetMeasurements(w http.ResponseWriter, r *http.Request) error {
+	params := r.URL.Query()
+	from, err := parseTimeParam(params, "from")
+	if err != nil {
+		return err
+	}
+	to, err := parseTimeParam(params, "to")
+	if err != nil {
+		return err
+	}
+	bucket := params.Get("bucket")
+	if bucket != "" && bucket != "day" && bucket != "week" {
+		return models.NewError(http.StatusBadRequest, "bucket must be one of day, week")
+	}
+	limit := 5
+	offset := 0
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limitTemp, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return models.NewError(http.StatusBadRequest, err.Error())
+		}
+		if limitTemp >= 0 {
+			limit = limitTemp
+		}
+	}
+	if offsetStr := params.Get("offset"); offsetStr != "" {
+		offsetTemp, err := strconv.Atoi(offsetStr)
+		if err != nil {
+			return models.NewError(http.StatusBadRequest, err.Error())
+		}
+		if offsetTemp >= 0 {
+			offset = offsetTemp
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+	prefs, err := h.requestUnits(w, r, userId)
+	if err != nil {
+		return err
+	}
+
+	if bucket != "" {
+		averages, err := h.measurementService.GetAverages(userId, bucket, from, to)
+		if err != nil {
+			return err
+		}
+
+		type averageResponse struct {
+			BucketStart       types.CustomTime `json:"bucketStart"`
+			Weight            pgtype.Float8    `json:"weight"`
+			BodyFatPercentage pgtype.Float8    `json:"bodyFatPercentage"`
+			Waist             pgtype.Float8    `json:"waist"`
+			RestingHeartRate  pgtype.Float8    `json:"restingHeartRate"`
+			Count             int              `json:"count"`
+		}
+		res := make([]averageResponse, 0, len(averages))
+		for _, average := range averages {
+			item := averageResponse{
+				BucketStart:       types.CustomTime(average.BucketStart),
+				Weight:            average.Weight,
+				BodyFatPercentage: average.BodyFatPercentage,
+				Waist:             average.Waist,
+				RestingHeartRate:  average.RestingHeartRate,
+				Count:             average.Count,
+			}
+			if item.Weight.Valid {
+				item.Weight.Float64 = units.FromKg(item.Weight.Float64, prefs.Weight)
+			}
+			if item.Waist.Valid {
+				item.Waist.Float64 = units.FromCm(item.Waist.Float64, prefs.Height)
+			}
+			res = append(res, item)
+		}
+		utils.SetJsonResponse(w, http.StatusOK, res)
+
+		return nil
+	}
+
+	measurements, err := h.measurementService.GetMeasurements(userId, from, to, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	res := make([]measurementResponse, 0, len(measurements))
+	for _, measurement := range measurements {
+		res = append(res, newMeasurementResponse(measurement, prefs))
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *MeasurementHandler) HandleDeleteMeasurement(w http.ResponseWriter, r *http.Request) error {
+	measurementId := r.PathValue("measurementId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	err = h.measurementService.DeleteMeasurement(measurementId, userId)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
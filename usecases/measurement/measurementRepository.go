@@ -0,0 +1,197 @@
+package measurement
+
+import (
+	"context"
+	"fit-byte/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// syncProfileWeightQuery makes the profile weight follow the latest weight
+// entry. The profile keeps its value when no entry has a weight.
+const syncProfileWeightQuery = `
+	UPDATE users SET weight = COALESCE((
+		SELECT weight
+		FROM body_measurements
+		WHERE user_id = @user_id AND weight IS NOT NULL
+		ORDER BY measured_at DESC, created_at DESC
+		LIMIT 1
+	), weight)
+	WHERE id = @user_id
+`
+
+type MeasurementRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewMeasurementRepository(ctx context.Context, pgConn *pgxpool.Pool) MeasurementRepository {
+	return MeasurementRepository{ctx, pgConn}
+}
+
+func (r *MeasurementRepository) Save(measurement models.BodyMeasurement) (*models.BodyMeasurement, error) {
+	query := `
+	INSERT INTO body_measurements (
+		user_id,
+		measured_at,
+		weight,
+		body_fat_percentage,
+		waist,
+		resting_heart_rate
+	)
+	VALUES (
+		@user_id,
+		@measured_at,
+		@weight,
+		@body_fat_percentage,
+		@waist,
+		@resting_heart_rate
+	)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"user_id":             measurement.UserId,
+		"measured_at":         measurement.MeasuredAt,
+		"weight":              measurement.Weight,
+		"body_fat_percentage": measurement.BodyFatPercentage,
+		"waist":               measurement.Waist,
+		"resting_heart_rate":  measurement.RestingHeartRate,
+	}
+
+	var newMeasurement models.BodyMeasurement
+	err := pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(r.ctx, query, args)
+		var err error
+		newMeasurement, err = pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.BodyMeasurement])
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(r.ctx, syncProfileWeightQuery, pgx.NamedArgs{"user_id": measurement.UserId})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &newMeasurement, nil
+}
+
+// ExistsAt tells whether the user has a measurement taken at measuredAt.
+func (r *MeasurementRepository) ExistsAt(userId string, measuredAt time.Time) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM body_measurements WHERE user_id = @user_id AND measured_at = @measured_at)`
+	args := pgx.NamedArgs{
+		"user_id":     userId,
+		"measured_at": measuredAt,
+	}
+
+	var exists bool
+	err := r.pgConn.QueryRow(r.ctx, query, args).Scan(&exists)
+
+	return exists, err
+}
+
+func (r *MeasurementRepository) FindAll(userId string, from *time.Time, to *time.Time, offset int, limit int) ([]models.BodyMeasurement, error) {
+	conditions := []string{"user_id = @user_id"}
+	args := pgx.NamedArgs{
+		"user_id": userId,
+		"limit":   limit,
+		"offset":  offset,
+	}
+	if from != nil {
+		conditions = append(conditions, "measured_at >= @from")
+		args["from"] = *from
+	}
+	if to != nil {
+		conditions = append(conditions, "measured_at <= @to")
+		args["to"] = *to
+	}
+
+	query := `
+	SELECT *
+	FROM body_measurements
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY measured_at DESC
+	LIMIT @limit
+	OFFSET @offset
+	`
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	measurements, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.BodyMeasurement])
+	if err != nil {
+		return nil, err
+	}
+
+	return measurements, nil
+}
+
+// FindAverages groups the measurements by day or week in the user's timezone.
+func (r *MeasurementRepository) FindAverages(userId string, bucket string, from *time.Time, to *time.Time) ([]models.BodyMeasurementAverage, error) {
+	conditions := []string{"m.user_id = @user_id"}
+	args := pgx.NamedArgs{
+		"user_id": userId,
+		"bucket":  bucket,
+	}
+	if from != nil {
+		conditions = append(conditions, "m.measured_at >= @from")
+		args["from"] = *from
+	}
+	if to != nil {
+		conditions = append(conditions, "m.measured_at <= @to")
+		args["to"] = *to
+	}
+
+	query := `
+	SELECT
+		date_trunc(@bucket, m.measured_at AT TIME ZONE u.timezone) AT TIME ZONE u.timezone AS bucket_start,
+		AVG(m.weight)::float8 AS weight,
+		AVG(m.body_fat_percentage)::float8 AS body_fat_percentage,
+		AVG(m.waist)::float8 AS waist,
+		AVG(m.resting_heart_rate)::float8 AS resting_heart_rate,
+		COUNT(*) AS count
+	FROM body_measurements m
+	JOIN users u ON u.id = m.user_id
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	GROUP BY bucket_start
+	ORDER BY bucket_start
+	`
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	averages, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.BodyMeasurementAverage])
+	if err != nil {
+		return nil, err
+	}
+
+	return averages, nil
+}
+
+func (r *MeasurementRepository) Delete(id string, userId string) error {
+	query := `DELETE FROM body_measurements WHERE id = @id AND user_id = @user_id`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+
+	return pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		commandTag, err := tx.Exec(r.ctx, query, args)
+		if err != nil {
+			return err
+		}
+		if commandTag.RowsAffected() == 0 {
+			return models.NewError(http.StatusNotFound, "")
+		}
+
+		_, err = tx.Exec(r.ctx, syncProfileWeightQuery, pgx.NamedArgs{"user_id": userId})
+		return err
+	})
+}
@@ -0,0 +1,113 @@
+package measurement
+
+import (
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/units"
+	"fit-byte/usecases/user"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type MeasurementService struct {
+	measurementRepository MeasurementRepository
+	userRepository        user.UserRepository
+}
+
+func NewMeasurementService(measurementRepository MeasurementRepository, userRepository user.UserRepository) MeasurementService {
+	return MeasurementService{measurementRepository, userRepository}
+}
+
+func (s *MeasurementService) GetPreferredUnits(userId string) (units.Preferences, error) {
+	currentUser, err := s.userRepository.FindById(userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return units.Preferences{}, models.NewError(http.StatusNotFound, "")
+		}
+
+		return units.Preferences{}, err
+	}
+
+	return user.PreferredUnits(currentUser), nil
+}
+
+// CreateMeasurement reads weight and waist in prefs and stores them in
+// kilograms and centimeters.
+func (s *MeasurementService) CreateMeasurement(measurement models.BodyMeasurement, prefs units.Preferences) (*models.BodyMeasurement, error) {
+	if measurement.Weight.Valid {
+		measurement.Weight.Float64 = units.ToKg(measurement.Weight.Float64, prefs.Weight)
+	}
+	if measurement.Waist.Valid {
+		measurement.Waist.Float64 = units.ToCm(measurement.Waist.Float64, prefs.Height)
+	}
+
+	newMeasurement, err := s.measurementRepository.Save(measurement)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMeasurement, nil
+}
+
+// RecordWeight adds a weight in kilograms, taken now, to the user's history.
+// It is how the profile weight is changed, so it keeps following the history.
+func (s *MeasurementService) RecordWeight(userId string, weight float64) error {
+	_, err := s.measurementRepository.Save(models.BodyMeasurement{
+		UserId:     userId,
+		MeasuredAt: time.Now(),
+		Weight:     pgtype.Float8{Float64: weight, Valid: true},
+	})
+
+	return err
+}
+
+// ImportMeasurement works like CreateMeasurement for a measurement taken from
+// another platform. It fails with 409 when the user already has one taken at
+// that time, most likely the same one imported before.
+func (s *MeasurementService) ImportMeasurement(measurement models.BodyMeasurement, prefs units.Preferences) (*models.BodyMeasurement, error) {
+	exists, err := s.measurementRepository.ExistsAt(measurement.UserId, measurement.MeasuredAt)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, models.NewError(http.StatusConflict, "A measurement was already taken at that time")
+	}
+
+	return s.CreateMeasurement(measurement, prefs)
+}
+
+func (s *MeasurementService) GetMeasurements(userId string, from *time.Time, to *time.Time, offset int, limit int) ([]models.BodyMeasurement, error) {
+	measurements, err := s.measurementRepository.FindAll(userId, from, to, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return measurements, nil
+}
+
+func (s *MeasurementService) GetAverages(userId string, bucket string, from *time.Time, to *time.Time) ([]models.BodyMeasurementAverage, error) {
+	averages, err := s.measurementRepository.FindAverages(userId, bucket, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return averages, nil
+}
+
+func (s *MeasurementService) DeleteMeasurement(id string, userId string) error {
+	err := s.measurementRepository.Delete(id, userId)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return models.NewError(http.StatusNotFound, "")
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package session
+
+import (
+	"fit-byte/models"
+	"fit-byte/utils"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+type SessionHandler struct {
+	sessionService SessionService
+}
+
+func NewSessionHandler(sessionService SessionService) SessionHandler {
+	return SessionHandler{sessionService}
+}
+
+// Verifier completes the jwt verifier: access tokens are only valid while the
+// session in their sid claim is, so revoking it logs the device out. Tokens
+// that failed verification, and challenge tokens, are left to the next
+// middlewares to reject.
+func (h *SessionHandler) Verifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, claims, err := jwtauth.FromContext(r.Context())
+		if err != nil || token == nil || claims["purpose"] != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sessionId, _ := claims["sid"].(string)
+		userId, _ := claims["userId"].(string)
+		active, err := h.sessionService.Touch(sessionId, userId, utils.GetClientIP(r))
+		if err != nil {
+			log.Println("Error checking session:", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), nil, jwtauth.ErrUnauthorized)))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *SessionHandler) HandleGetSessions(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+	currentId, _ := claims["sid"].(string)
+
+	sessions, err := h.sessionService.GetSessions(userId)
+	if err != nil {
+		return err
+	}
+
+	type sessionResponse struct {
+		models.Session
+		Current bool `json:"current"`
+	}
+	res := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, sessionResponse{
+			Session: session,
+			Current: session.Id == currentId,
+		})
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *SessionHandler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) error {
+	sessionId := r.PathValue("sessionId")
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	err = h.sessionService.RevokeSession(sessionId, userId)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
+
+// HandleRevokeOtherSessions logs the user out of every session but the one
+// making the request.
+func (h *SessionHandler) HandleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+	currentId, _ := claims["sid"].(string)
+
+	err = h.sessionService.RevokeOtherSessions(userId, currentId)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
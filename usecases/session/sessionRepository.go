@@ -0,0 +1,159 @@
+package session
+
+import (
+	"context"
+	"fit-byte/models"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SessionRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewSessionRepository(ctx context.Context, pgConn *pgxpool.Pool) SessionRepository {
+	return SessionRepository{ctx, pgConn}
+}
+
+func (r *SessionRepository) Save(session models.Session) (*models.Session, error) {
+	query := `
+	INSERT INTO sessions (
+		user_id,
+		device_name,
+		user_agent,
+		ip,
+		expires_at
+	)
+	VALUES (
+		@user_id,
+		@device_name,
+		@user_agent,
+		@ip,
+		@expires_at
+	)
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"user_id":     session.UserId,
+		"device_name": session.DeviceName,
+		"user_agent":  session.UserAgent,
+		"ip":          session.Ip,
+		"expires_at":  session.ExpiresAt,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	newSession, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.Session])
+	if err != nil {
+		return nil, err
+	}
+
+	return &newSession, nil
+}
+
+// FindActiveLastSeenAt returns when the session was last seen, or pgx.ErrNoRows
+// when it is revoked, expired or not the user's.
+func (r *SessionRepository) FindActiveLastSeenAt(id string, userId string) (time.Time, error) {
+	query := `
+	SELECT last_seen_at
+	FROM sessions
+	WHERE id = @id
+		AND user_id = @user_id
+		AND revoked_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP
+	`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+
+	var lastSeenAt time.Time
+	if err := r.pgConn.QueryRow(r.ctx, query, args).Scan(&lastSeenAt); err != nil {
+		return time.Time{}, err
+	}
+
+	return lastSeenAt, nil
+}
+
+func (r *SessionRepository) UpdateLastSeen(id string, ip string) error {
+	query := `UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP, ip = @ip WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id": id,
+		"ip": ip,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+func (r *SessionRepository) FindAllActiveByUserId(userId string) ([]models.Session, error) {
+	query := `
+	SELECT *
+	FROM sessions
+	WHERE user_id = @user_id
+		AND revoked_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP
+	ORDER BY last_seen_at DESC
+	`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Session])
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (r *SessionRepository) Revoke(id string, userId string) error {
+	query := `
+	UPDATE sessions
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE id = @id AND user_id = @user_id AND revoked_at IS NULL
+	`
+	args := pgx.NamedArgs{
+		"id":      id,
+		"user_id": userId,
+	}
+
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return models.NewError(http.StatusNotFound, "")
+	}
+
+	return nil
+}
+
+// RevokeAll revokes every session of the user but exceptId, which can be
+// empty to revoke them all.
+func (r *SessionRepository) RevokeAll(userId string, exceptId string) error {
+	query := `
+	UPDATE sessions
+	SET revoked_at = CURRENT_TIMESTAMP
+	WHERE user_id = @user_id
+		AND revoked_at IS NULL
+		AND (@except_id = '' OR id::text <> @except_id)
+	`
+	args := pgx.NamedArgs{
+		"user_id":   userId,
+		"except_id": exceptId,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"errors"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// lastSeenPrecision is how stale last_seen_at may get, so that every request
+// doesn't write to the sessions table.
+const lastSeenPrecision = time.Minute
+
+// Device describes where a login comes from.
+type Device struct {
+	Name      string
+	UserAgent string
+	Ip        string
+}
+
+type SessionService struct {
+	sessionRepository SessionRepository
+}
+
+func NewSessionService(sessionRepository SessionRepository) SessionService {
+	return SessionService{sessionRepository}
+}
+
+// CreateSession records a login, lasting as long as an access token.
+func (s *SessionService) CreateSession(userId string, device Device) (*models.Session, error) {
+	return s.sessionRepository.Save(models.Session{
+		UserId:     userId,
+		DeviceName: pgtype.Text{String: device.Name, Valid: device.Name != ""},
+		UserAgent:  pgtype.Text{String: device.UserAgent, Valid: device.UserAgent != ""},
+		Ip:         pgtype.Text{String: device.Ip, Valid: device.Ip != ""},
+		ExpiresAt:  time.Now().Add(constants.ACCESS_TOKEN_TTL),
+	})
+}
+
+// Touch tells whether the session is still active, and records it was seen
+// from ip.
+func (s *SessionService) Touch(id string, userId string, ip string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+
+	lastSeenAt, err := s.sessionRepository.FindActiveLastSeenAt(id, userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if time.Since(lastSeenAt) > lastSeenPrecision {
+		if err := s.sessionRepository.UpdateLastSeen(id, ip); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (s *SessionService) GetSessions(userId string) ([]models.Session, error) {
+	return s.sessionRepository.FindAllActiveByUserId(userId)
+}
+
+func (s *SessionService) RevokeSession(id string, userId string) error {
+	err := s.sessionRepository.Revoke(id, userId)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == constants.INVALID_INPUT_SYNTAX_TYPE_ERROR_CODE {
+			return models.NewError(http.StatusNotFound, "")
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions logs the user out everywhere but currentId, which can
+// be empty to log them out everywhere.
+func (s *SessionService) RevokeOtherSessions(userId string, currentId string) error {
+	return s.sessionRepository.RevokeAll(userId, currentId)
+}
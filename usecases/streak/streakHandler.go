@@ -0,0 +1,110 @@
+package streak
+
+import (
+	"encoding/json"
+	"fit-byte/models"
+	"fit-byte/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type StreakHandler struct {
+	streakService StreakService
+}
+
+func NewStreakHandler(streakService StreakService) StreakHandler {
+	return StreakHandler{streakService}
+}
+
+type streakResponse struct {
+	Length    int     `json:"length"`
+	StartDate *string `json:"startDate"`
+	EndDate   *string `json:"endDate"`
+}
+
+func toStreakResponse(streak models.Streak) streakResponse {
+	res := streakResponse{Length: streak.Length}
+	if streak.Length > 0 {
+		startDate := streak.StartDate.Format("2006-01-02")
+		endDate := streak.EndDate.Format("2006-01-02")
+		res.StartDate = &startDate
+		res.EndDate = &endDate
+	}
+
+	return res
+}
+
+func (h *StreakHandler) HandleGetStreaks(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	streaks, settings, err := h.streakService.GetStreaks(userId)
+	if err != nil {
+		return err
+	}
+
+	type streakPair struct {
+		Current streakResponse `json:"current"`
+		Longest streakResponse `json:"longest"`
+	}
+	res := struct {
+		Daily    streakPair            `json:"daily"`
+		Weekly   streakPair            `json:"weekly"`
+		Settings models.StreakSettings `json:"settings"`
+	}{
+		Daily: streakPair{
+			Current: toStreakResponse(streaks.CurrentDaily),
+			Longest: toStreakResponse(streaks.LongestDaily),
+		},
+		Weekly: streakPair{
+			Current: toStreakResponse(streaks.CurrentWeekly),
+			Longest: toStreakResponse(streaks.LongestWeekly),
+		},
+		Settings: *settings,
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *StreakHandler) HandleUpdateStreakSettings(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		RestDaysPerWeek  *int `json:"restDaysPerWeek" validate:"required,min=0,max=6"`
+		WeeklyActiveDays *int `json:"weeklyActiveDays" validate:"required,min=1,max=7"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	settings, err := h.streakService.UpdateSettings(models.StreakSettings{
+		UserId:           userId,
+		RestDaysPerWeek:  *payload.RestDaysPerWeek,
+		WeeklyActiveDays: *payload.WeeklyActiveDays,
+	})
+	if err != nil {
+		return err
+	}
+
+	utils.SetJsonResponse(w, http.StatusOK, settings)
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package streak
+
+import (
+	"context"
+	"errors"
+	"fit-byte/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type StreakRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewStreakRepository(ctx context.Context, pgConn *pgxpool.Pool) StreakRepository {
+	return StreakRepository{ctx, pgConn}
+}
+
+// FindActiveDays returns every distinct day, in the user's timezone, the user
+// did an activity on, oldest first.
+func (r *StreakRepository) FindActiveDays(userId string) ([]time.Time, error) {
+	query := `
+	SELECT DISTINCT (a.done_at AT TIME ZONE u.timezone)::date AS day
+	FROM activities a
+	JOIN users u ON u.id = a.user_id
+	WHERE a.user_id = @user_id AND a.deleted_at IS NULL
+	ORDER BY day
+	`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := pgx.CollectRows(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return nil, err
+	}
+
+	return days, nil
+}
+
+func (r *StreakRepository) FindSettingsByUserId(userId string) (*models.StreakSettings, error) {
+	query := `SELECT * FROM streak_settings WHERE user_id = @user_id`
+	args := pgx.NamedArgs{
+		"user_id": userId,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	settings, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.StreakSettings])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &models.StreakSettings{
+				UserId:           userId,
+				RestDaysPerWeek:  0,
+				WeeklyActiveDays: 1,
+			}, nil
+		}
+
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+func (r *StreakRepository) SaveSettings(settings models.StreakSettings) (*models.StreakSettings, error) {
+	query := `
+	INSERT INTO streak_settings (
+		user_id,
+		rest_days_per_week,
+		weekly_active_days
+	)
+	VALUES (
+		@user_id,
+		@rest_days_per_week,
+		@weekly_active_days
+	)
+	ON CONFLICT (user_id) DO UPDATE SET
+		rest_days_per_week = EXCLUDED.rest_days_per_week,
+		weekly_active_days = EXCLUDED.weekly_active_days,
+		updated_at = CURRENT_TIMESTAMP
+	RETURNING *
+	`
+	args := pgx.NamedArgs{
+		"user_id":            settings.UserId,
+		"rest_days_per_week": settings.RestDaysPerWeek,
+		"weekly_active_days": settings.WeeklyActiveDays,
+	}
+
+	rows, _ := r.pgConn.Query(r.ctx, query, args)
+	newSettings, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[models.StreakSettings])
+	if err != nil {
+		return nil, err
+	}
+
+	return &newSettings, nil
+}
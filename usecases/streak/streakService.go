@@ -0,0 +1,141 @@
+package streak
+
+import (
+	"fit-byte/models"
+	"fit-byte/usecases/user"
+	"time"
+)
+
+type StreakService struct {
+	streakRepository StreakRepository
+	userRepository   user.UserRepository
+}
+
+func NewStreakService(streakRepository StreakRepository, userRepository user.UserRepository) StreakService {
+	return StreakService{streakRepository, userRepository}
+}
+
+// GetStreaks computes the streaks from the activities as they are stored right
+// now. Nothing is cached, so back-dated, edited and deleted activities are
+// always reflected.
+func (s *StreakService) GetStreaks(userId string) (*models.Streaks, *models.StreakSettings, error) {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	location, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings, err := s.streakRepository.FindSettingsByUserId(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	days, err := s.streakRepository.FindActiveDays(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// active days are plain dates, so today is expressed the same way
+	now := time.Now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	streaks := models.Streaks{}
+	streaks.CurrentDaily, streaks.LongestDaily = computeDailyStreaks(days, today, settings.RestDaysPerWeek)
+	streaks.CurrentWeekly, streaks.LongestWeekly = computeWeeklyStreaks(days, today, settings.WeeklyActiveDays)
+
+	return &streaks, settings, nil
+}
+
+func (s *StreakService) UpdateSettings(settings models.StreakSettings) (*models.StreakSettings, error) {
+	newSettings, err := s.streakRepository.SaveSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSettings, nil
+}
+
+func startOfWeek(day time.Time) time.Time {
+	// weeks start on monday
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// computeDailyStreaks walks every day from the first active day up to today.
+// Up to restDaysPerWeek inactive days per calendar week don't break a streak,
+// and today never breaks it since the day isn't over yet.
+func computeDailyStreaks(days []time.Time, today time.Time, restDaysPerWeek int) (models.Streak, models.Streak) {
+	if len(days) == 0 {
+		return models.Streak{}, models.Streak{}
+	}
+
+	active := make(map[time.Time]bool, len(days))
+	for _, day := range days {
+		active[day] = true
+	}
+
+	var current, longest models.Streak
+	var week time.Time
+	restDaysUsed := 0
+	for day := days[0]; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if weekStart := startOfWeek(day); !weekStart.Equal(week) {
+			week = weekStart
+			restDaysUsed = 0
+		}
+
+		switch {
+		case active[day]:
+			if current.Length == 0 {
+				current.StartDate = day
+			}
+			current.Length++
+			current.EndDate = day
+			if current.Length > longest.Length {
+				longest = current
+			}
+		case day.Equal(today):
+		case current.Length > 0 && restDaysUsed < restDaysPerWeek:
+			restDaysUsed++
+		default:
+			current = models.Streak{}
+		}
+	}
+
+	return current, longest
+}
+
+// computeWeeklyStreaks counts consecutive weeks having at least
+// weeklyActiveDays active days. The current week never breaks a streak.
+func computeWeeklyStreaks(days []time.Time, today time.Time, weeklyActiveDays int) (models.Streak, models.Streak) {
+	if len(days) == 0 {
+		return models.Streak{}, models.Streak{}
+	}
+
+	activeDaysPerWeek := map[time.Time]int{}
+	for _, day := range days {
+		activeDaysPerWeek[startOfWeek(day)]++
+	}
+
+	var current, longest models.Streak
+	thisWeek := startOfWeek(today)
+	for week := startOfWeek(days[0]); !week.After(thisWeek); week = week.AddDate(0, 0, 7) {
+		switch {
+		case activeDaysPerWeek[week] >= weeklyActiveDays:
+			if current.Length == 0 {
+				current.StartDate = week
+			}
+			current.Length++
+			current.EndDate = week.AddDate(0, 0, 6)
+			if current.Length > longest.Length {
+				longest = current
+			}
+		case week.Equal(thisWeek):
+		default:
+			current = models.Streak{}
+		}
+	}
+
+	return current, longest
+}
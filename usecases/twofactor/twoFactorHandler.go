@@ -0,0 +1,149 @@
+package twofactor
+
+import (
+	"encoding/json"
+	"fit-byte/models"
+	"fit-byte/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type TwoFactorHandler struct {
+	twoFactorService TwoFactorService
+}
+
+func NewTwoFactorHandler(twoFactorService TwoFactorService) TwoFactorHandler {
+	return TwoFactorHandler{twoFactorService}
+}
+
+func (h *TwoFactorHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) error {
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	secret, uri, err := h.twoFactorService.Enroll(userId)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		Secret     string `json:"secret"`
+		OtpauthUri string `json:"otpauthUri"`
+	}{
+		Secret:     secret,
+		OtpauthUri: uri,
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *TwoFactorHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Code string `json:"code" validate:"required,numeric,len=6"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	recoveryCodes, err := h.twoFactorService.Confirm(userId, payload.Code)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{
+		RecoveryCodes: recoveryCodes,
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *TwoFactorHandler) HandleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Code string `json:"code" validate:"required,numeric,len=6"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	recoveryCodes, err := h.twoFactorService.RegenerateRecoveryCodes(userId, payload.Code)
+	if err != nil {
+		return err
+	}
+
+	res := struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{
+		RecoveryCodes: recoveryCodes,
+	}
+	utils.SetJsonResponse(w, http.StatusOK, res)
+
+	return nil
+}
+
+func (h *TwoFactorHandler) HandleDisable(w http.ResponseWriter, r *http.Request) error {
+	payload := struct {
+		Password     string `json:"password" validate:"required"`
+		Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+		RecoveryCode string `json:"recoveryCode" validate:"required_without=Code"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return models.NewError(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			validationErr := fmt.Errorf("validation for '%s' failed", err.Field())
+			return models.NewError(http.StatusBadRequest, validationErr.Error())
+		}
+	}
+
+	_, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil {
+		return models.NewError(http.StatusInternalServerError, err.Error())
+	}
+	userId := claims["userId"].(string)
+
+	err = h.twoFactorService.Disable(userId, payload.Password, payload.Code, payload.RecoveryCode)
+	if err != nil {
+		return err
+	}
+
+	w.Write([]byte(""))
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package twofactor
+
+import (
+	"context"
+	"fit-byte/models"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TwoFactorRepository struct {
+	ctx    context.Context
+	pgConn *pgxpool.Pool
+}
+
+func NewTwoFactorRepository(ctx context.Context, pgConn *pgxpool.Pool) TwoFactorRepository {
+	return TwoFactorRepository{ctx, pgConn}
+}
+
+// SaveSecret stores the secret of a pending enrollment. It fails with a
+// conflict when two-factor authentication is already enabled.
+func (r *TwoFactorRepository) SaveSecret(userId string, encryptedSecret string) error {
+	query := `UPDATE users SET totp_secret = @totp_secret WHERE id = @id AND totp_enabled_at IS NULL`
+	args := pgx.NamedArgs{
+		"id":          userId,
+		"totp_secret": encryptedSecret,
+	}
+
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return models.NewError(http.StatusConflict, "Two-factor authentication is already enabled")
+	}
+
+	return nil
+}
+
+func insertRecoveryCodes(ctx context.Context, tx pgx.Tx, userId string, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = @user_id`, pgx.NamedArgs{"user_id": userId}); err != nil {
+		return err
+	}
+
+	rows := make([][]any, 0, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		rows = append(rows, []any{userId, codeHash})
+	}
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"recovery_codes"}, []string{"user_id", "code_hash"}, pgx.CopyFromRows(rows))
+
+	return err
+}
+
+// Enable turns two-factor authentication on, with counter being the time step
+// of the code that confirmed the enrollment.
+func (r *TwoFactorRepository) Enable(userId string, counter int64, codeHashes []string) error {
+	return pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		commandTag, err := tx.Exec(r.ctx, `
+		UPDATE users
+		SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_counter = @counter
+		WHERE id = @id AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+		`, pgx.NamedArgs{
+			"id":      userId,
+			"counter": counter,
+		})
+		if err != nil {
+			return err
+		}
+		if commandTag.RowsAffected() == 0 {
+			return models.NewError(http.StatusConflict, "Two-factor authentication is already enabled")
+		}
+
+		return insertRecoveryCodes(r.ctx, tx, userId, codeHashes)
+	})
+}
+
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(userId string, codeHashes []string) error {
+	return pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		return insertRecoveryCodes(r.ctx, tx, userId, codeHashes)
+	})
+}
+
+// UseCounter records the time step of an accepted code. It returns false when
+// a code of that step or a later one was already used.
+func (r *TwoFactorRepository) UseCounter(userId string, counter int64) (bool, error) {
+	query := `UPDATE users SET totp_last_counter = @counter WHERE id = @id AND totp_last_counter < @counter`
+	args := pgx.NamedArgs{
+		"id":      userId,
+		"counter": counter,
+	}
+
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode marks the code as used and returns false when the user has
+// no such unused code.
+func (r *TwoFactorRepository) UseRecoveryCode(userId string, codeHash string) (bool, error) {
+	query := `
+	UPDATE recovery_codes
+	SET used_at = CURRENT_TIMESTAMP
+	WHERE user_id = @user_id AND code_hash = @code_hash AND used_at IS NULL
+	`
+	args := pgx.NamedArgs{
+		"user_id":   userId,
+		"code_hash": codeHash,
+	}
+
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return false, err
+	}
+
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (r *TwoFactorRepository) Disable(userId string) error {
+	return pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(r.ctx, `
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_counter = 0
+		WHERE id = @id
+		`, pgx.NamedArgs{"id": userId})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(r.ctx, `DELETE FROM recovery_codes WHERE user_id = @user_id`, pgx.NamedArgs{"user_id": userId})
+		return err
+	})
+}
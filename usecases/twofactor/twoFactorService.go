@@ -0,0 +1,208 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fit-byte/constants"
+	"fit-byte/models"
+	"fit-byte/password"
+	"fit-byte/totp"
+	"fit-byte/usecases/user"
+	"fit-byte/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type TwoFactorService struct {
+	twoFactorRepository TwoFactorRepository
+	userRepository      user.UserRepository
+	encryptionKey       []byte
+	passwordHasher      *password.Hasher
+}
+
+// NewTwoFactorService takes the 32 bytes key TOTP secrets are encrypted with.
+// Enrollment is refused when it is empty.
+func NewTwoFactorService(twoFactorRepository TwoFactorRepository, userRepository user.UserRepository, encryptionKey []byte, passwordHasher *password.Hasher) TwoFactorService {
+	return TwoFactorService{twoFactorRepository, userRepository, encryptionKey, passwordHasher}
+}
+
+// Enroll generates a new secret for the user, to be confirmed with a first
+// code before it is required at login.
+func (s *TwoFactorService) Enroll(userId string) (string, string, error) {
+	if len(s.encryptionKey) == 0 {
+		return "", "", models.NewError(http.StatusServiceUnavailable, "Two-factor authentication is not configured")
+	}
+
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TotpEnabledAt.Valid {
+		return "", "", models.NewError(http.StatusConflict, "Two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	encryptedSecret, err := utils.EncryptSecret(s.encryptionKey, secret)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.twoFactorRepository.SaveSecret(userId, encryptedSecret); err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URI(constants.TWO_FACTOR_ISSUER, user.Email, secret), nil
+}
+
+// Confirm enables two-factor authentication once the user proves their app
+// produces the right codes, and returns the recovery codes in plain text. They
+// are not retrievable afterwards.
+func (s *TwoFactorService) Confirm(userId string, code string) ([]string, error) {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabledAt.Valid {
+		return nil, models.NewError(http.StatusConflict, "Two-factor authentication is already enabled")
+	}
+	if !user.TotpSecret.Valid {
+		return nil, models.NewError(http.StatusBadRequest, "Two-factor authentication enrollment has not started")
+	}
+
+	counter, ok, err := s.validateCode(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, models.NewError(http.StatusBadRequest, "Invalid code")
+	}
+
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepository.Enable(userId, counter, codeHashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify checks a second factor of a user having two-factor authentication
+// enabled: either a code from their app or one of their recovery codes. Both
+// can only be used once.
+func (s *TwoFactorService) Verify(user *models.User, code string, recoveryCode string) (bool, error) {
+	if !user.TotpEnabledAt.Valid {
+		return false, nil
+	}
+
+	if recoveryCode != "" {
+		return s.twoFactorRepository.UseRecoveryCode(user.Id, hashRecoveryCode(recoveryCode))
+	}
+
+	counter, ok, err := s.validateCode(user, code)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return s.twoFactorRepository.UseCounter(user.Id, counter)
+}
+
+func (s *TwoFactorService) RegenerateRecoveryCodes(userId string, code string) ([]string, error) {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TotpEnabledAt.Valid {
+		return nil, models.NewError(http.StatusBadRequest, "Two-factor authentication is not enabled")
+	}
+
+	ok, err := s.Verify(user, code, "")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, models.NewError(http.StatusBadRequest, "Invalid code")
+	}
+
+	codes, codeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepository.ReplaceRecoveryCodes(userId, codeHashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *TwoFactorService) Disable(userId string, password string, code string, recoveryCode string) error {
+	user, err := s.userRepository.FindById(userId)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabledAt.Valid {
+		return models.NewError(http.StatusBadRequest, "Two-factor authentication is not enabled")
+	}
+	if match, _ := s.passwordHasher.Verify(user.Password, password); !match {
+		return models.NewError(http.StatusUnauthorized, "Invalid password")
+	}
+
+	ok, err := s.Verify(user, code, recoveryCode)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return models.NewError(http.StatusBadRequest, "Invalid code")
+	}
+
+	return s.twoFactorRepository.Disable(userId)
+}
+
+func (s *TwoFactorService) validateCode(user *models.User, code string) (int64, bool, error) {
+	if len(s.encryptionKey) == 0 || !user.TotpSecret.Valid {
+		return 0, false, nil
+	}
+
+	secret, err := utils.DecryptSecret(s.encryptionKey, user.TotpSecret.String)
+	if err != nil {
+		return 0, false, err
+	}
+
+	counter, ok := totp.Validate(secret, code, time.Now(), user.TotpLastCounter)
+	return counter, ok, nil
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes like "abcde-fghij" along with the hashes
+// to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, constants.RECOVERY_CODE_COUNT)
+	codeHashes := make([]string, 0, constants.RECOVERY_CODE_COUNT)
+	for range constants.RECOVERY_CODE_COUNT {
+		bytes := make([]byte, 7)
+		if _, err := rand.Read(bytes); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(bytes))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		codeHashes = append(codeHashes, hashRecoveryCode(code))
+	}
+
+	return codes, codeHashes, nil
+}
+
+// hashRecoveryCode ignores case, dashes and spaces, so codes can be typed in
+// loosely.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+
+	return utils.HashToken(code)
+}
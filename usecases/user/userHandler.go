@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fit-byte/models"
 	"fit-byte/types"
+	"fit-byte/units"
 	"fit-byte/utils"
 	"fmt"
 	"net/http"
@@ -21,6 +22,35 @@ func NewUserHandler(userService UserService) UserHandler {
 	return UserHandler{userService}
 }
 
+// displayUnits picks the units to present the user's body metrics in: an
+// Accept-Units request header wins over the stored preferences. The choice is
+// echoed back in the Content-Units response header.
+func displayUnits(r *http.Request, user *models.User) units.Preferences {
+	return units.ParseAcceptUnits(r.Header.Get("Accept-Units"), PreferredUnits(user))
+}
+
+// profileETag tells apart the versions of the profile, and the units it is
+// displayed in.
+func profileETag(user *models.User, prefs units.Preferences) string {
+	return utils.ETag(user.Version, prefs.Weight+"."+prefs.Height)
+}
+
+func toDisplayWeight(weight pgtype.Float8, prefs units.Preferences) pgtype.Float8 {
+	if !weight.Valid {
+		return weight
+	}
+
+	return pgtype.Float8{Float64: units.FromKg(weight.Float64, prefs.Weight), Valid: true}
+}
+
+func toDisplayHeight(height pgtype.Float8, prefs units.Preferences) pgtype.Float8 {
+	if !height.Valid {
+		return height
+	}
+
+	return pgtype.Float8{Float64: units.FromCm(height.Float64, prefs.Height), Valid: true}
+}
+
 func (h *UserHandler) HandleGetUser(w http.ResponseWriter, r *http.Request) error {
 	_, claims, err := jwtauth.FromContext(r.Context())
 	if err != nil {
@@ -31,25 +61,38 @@ func (h *UserHandler) HandleGetUser(w http.ResponseWriter, r *http.Request) erro
 	if err != nil {
 		return models.NewError(http.StatusInternalServerError, err.Error())
 	}
+	prefs := displayUnits(r, user)
 
 	res := struct {
 		Preference pgtype.Text `json:"preference"`
 		WeightUnit pgtype.Text `json:"weightUnit"`
 		HeightUnit pgtype.Text `json:"heightUnit"`
-		Weight     pgtype.Int4 `json:"weight"`
-		Height     pgtype.Int4 `json:"height"`
+		Weight     pgtype.Float8 `json:"weight"`
+		Height     pgtype.Float8 `json:"height"`
 		Email      string      `json:"email"`
+		EmailVerified bool     `json:"emailVerified"`
 		Name       pgtype.Text `json:"name"`
 		ImageUri   pgtype.Text `json:"imageUri"`
+		Timezone   string      `json:"timezone"`
+		Role       string      `json:"role"`
+		DeletionScheduledAt pgtype.Timestamptz `json:"deletionScheduledAt"`
 	}{
 		Preference: user.Preference,
 		WeightUnit: user.WeightUnit,
 		HeightUnit: user.HeightUnit,
-		Weight:     user.Weight,
-		Height:     user.Height,
+		Weight:     toDisplayWeight(user.Weight, prefs),
+		Height:     toDisplayHeight(user.Height, prefs),
 		Email:      user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 		Name:       user.Name,
 		ImageUri:   user.ImageUri,
+		Timezone:   user.Timezone,
+		Role:       user.Role,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+	w.Header().Set("Content-Units", prefs.String())
+	if utils.NotModified(w, r, profileETag(user, prefs)) {
+		return nil
 	}
 	utils.SetJsonResponse(w, http.StatusOK, res)
 
@@ -57,6 +100,10 @@ func (h *UserHandler) HandleGetUser(w http.ResponseWriter, r *http.Request) erro
 }
 
 func (h *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) error {
+	version, err := utils.IfMatchVersion(r)
+	if err != nil {
+		return err
+	}
 	payload := types.UpdateUserPayload{}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		return models.NewError(http.StatusBadRequest, err.Error())
@@ -92,28 +139,33 @@ func (h *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) e
 		return models.NewError(http.StatusInternalServerError, err.Error())
 	}
 	userId := claims["userId"].(string)
-	user, err := h.userService.PartialUpdate(userId, payload)
+	user, err := h.userService.PartialUpdate(userId, version, payload)
 	if err != nil {
 		return err
 	}
+	prefs := displayUnits(r, user)
 
 	res := struct {
 		Preference pgtype.Text `json:"preference"`
 		WeightUnit pgtype.Text `json:"weightUnit"`
 		HeightUnit pgtype.Text `json:"heightUnit"`
-		Weight     pgtype.Int4 `json:"weight"`
-		Height     pgtype.Int4 `json:"height"`
+		Weight     pgtype.Float8 `json:"weight"`
+		Height     pgtype.Float8 `json:"height"`
 		Name       pgtype.Text `json:"name"`
 		ImageUri   pgtype.Text `json:"imageUri"`
+		Timezone   string      `json:"timezone"`
 	}{
 		Preference: user.Preference,
 		WeightUnit: user.WeightUnit,
 		HeightUnit: user.HeightUnit,
-		Weight:     user.Weight,
-		Height:     user.Height,
+		Weight:     toDisplayWeight(user.Weight, prefs),
+		Height:     toDisplayHeight(user.Height, prefs),
 		Name:       user.Name,
 		ImageUri:   user.ImageUri,
+		Timezone:   user.Timezone,
 	}
+	w.Header().Set("Content-Units", prefs.String())
+	w.Header().Set("ETag", profileETag(user, prefs))
 	utils.SetJsonResponse(w, http.StatusOK, res)
 
 	return nil
@@ -6,6 +6,7 @@ import (
 	"fit-byte/types"
 	"fit-byte/utils"
 	"fmt"
+	"net/http"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -76,8 +77,14 @@ func (r *UserRepository) FindById(id string) (*models.User, error) {
 	return &user, nil
 }
 
-func (r *UserRepository) PartialUpdate(id string, payload types.UpdateUserPayload) (*models.User, error) {
-	query, args, err := utils.BuildPartialUpdateQuery("users", "id", id, &payload)
+// PartialUpdate only applies when the profile is still at version, if given,
+// and returns pgx.ErrNoRows otherwise.
+func (r *UserRepository) PartialUpdate(id string, version *int, payload types.UpdateUserPayload) (*models.User, error) {
+	scope := map[string]any{}
+	if version != nil {
+		scope["version"] = *version
+	}
+	query, args, err := utils.BuildScopedPartialUpdateQuery("users", "id", id, scope, &payload)
 	if err != nil {
 		return nil, err
 	}
@@ -93,4 +100,117 @@ func (r *UserRepository) PartialUpdate(id string, payload types.UpdateUserPayloa
 	}
 
 	return &user, nil
-}
\ No newline at end of file
+}
+
+func (r *UserRepository) UpdatePassword(id string, hashedPassword string) error {
+	query := `UPDATE users SET password = @password WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":       id,
+		"password": hashedPassword,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+// UpdateEmail swaps the user's email for one they confirmed receiving mail
+// at, so it is verified as well, and drops the tokens mailed to the previous
+// address: resetting the password or verifying the email now goes through
+// the new one.
+func (r *UserRepository) UpdateEmail(id string, email string) error {
+	return pgx.BeginFunc(r.ctx, r.pgConn, func(tx pgx.Tx) error {
+		query := `UPDATE users SET email = @email, email_verified_at = CURRENT_TIMESTAMP WHERE id = @id`
+		args := pgx.NamedArgs{
+			"id":    id,
+			"email": email,
+		}
+		if _, err := tx.Exec(r.ctx, query, args); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(r.ctx, `DELETE FROM user_tokens WHERE user_id = @user_id`, pgx.NamedArgs{"user_id": id})
+		return err
+	})
+}
+
+func (r *UserRepository) MarkEmailVerified(id string) error {
+	query := `UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = @id AND email_verified_at IS NULL`
+	args := pgx.NamedArgs{
+		"id": id,
+	}
+
+	_, err := r.pgConn.Exec(r.ctx, query, args)
+
+	return err
+}
+
+// Search finds users whose email or name contains search, all of them when it
+// is empty.
+func (r *UserRepository) Search(search string, offset int, limit int) ([]models.User, error) {
+	query := `
+	SELECT *
+	FROM users
+	WHERE @search = '' OR email ILIKE '%' || @search || '%' OR name ILIKE '%' || @search || '%'
+	ORDER BY email
+	LIMIT @limit
+	OFFSET @offset
+	`
+	args := pgx.NamedArgs{
+		"search": search,
+		"limit":  limit,
+		"offset": offset,
+	}
+
+	rows, err := r.pgConn.Query(r.ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.User])
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *UserRepository) SetDisabled(id string, disabled bool) error {
+	query := `
+	UPDATE users
+	SET disabled_at = CASE WHEN @disabled THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END
+	WHERE id = @id
+	`
+	args := pgx.NamedArgs{
+		"id":       id,
+		"disabled": disabled,
+	}
+
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return models.NewError(http.StatusNotFound, "")
+	}
+
+	return nil
+}
+
+func (r *UserRepository) UpdateRole(id string, role string) error {
+	query := `UPDATE users SET role = @role WHERE id = @id`
+	args := pgx.NamedArgs{
+		"id":   id,
+		"role": role,
+	}
+
+	commandTag, err := r.pgConn.Exec(r.ctx, query, args)
+	if err != nil {
+		return err
+	}
+	if commandTag.RowsAffected() == 0 {
+		return models.NewError(http.StatusNotFound, "")
+	}
+
+	return nil
+}
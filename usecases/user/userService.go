@@ -4,17 +4,25 @@ import (
 	"errors"
 	"fit-byte/models"
 	"fit-byte/types"
+	"fit-byte/units"
 	"net/http"
 
 	"github.com/jackc/pgx/v5"
 )
 
+// WeightRecorder adds a weight in kilograms, taken now, to the user's weight
+// history. The profile weight follows the latest entry of the history.
+type WeightRecorder interface {
+	RecordWeight(userId string, weight float64) error
+}
+
 type UserService struct {
 	userRepository UserRepository
+	weightRecorder WeightRecorder
 }
 
-func NewUserService(userRepository UserRepository) UserService {
-	return UserService{userRepository}
+func NewUserService(userRepository UserRepository, weightRecorder WeightRecorder) UserService {
+	return UserService{userRepository, weightRecorder}
 }
 
 func (s *UserService) FindById(id string) (*models.User, error) {
@@ -30,11 +38,69 @@ func (s *UserService) FindById(id string) (*models.User, error) {
 	return user, nil
 }
 
-func (s *UserService) PartialUpdate(id string, payload types.UpdateUserPayload) (*models.User, error) {
-	user, err := s.userRepository.PartialUpdate(id, payload)
+// PartialUpdate stores weight and height in kilograms and centimeters. Incoming
+// values are read in the units sent along with them, falling back to the
+// units the user currently prefers. A weight is recorded in the weight history
+// rather than written to the profile, which follows the history. It fails
+// with 412, writing nothing, when version, the one the client last saw, is
+// given and the profile was modified since.
+func (s *UserService) PartialUpdate(id string, version *int, payload types.UpdateUserPayload) (*models.User, error) {
+	if payload.Weight != nil || payload.Height != nil {
+		prefs := units.Metric
+		if payload.WeightUnit == nil || payload.HeightUnit == nil {
+			current, err := s.FindById(id)
+			if err != nil {
+				return nil, err
+			}
+			prefs = PreferredUnits(current)
+		}
+		if payload.WeightUnit != nil {
+			prefs.Weight = *payload.WeightUnit
+		}
+		if payload.HeightUnit != nil {
+			prefs.Height = *payload.HeightUnit
+		}
+
+		if payload.Weight != nil {
+			weight := units.ToKg(*payload.Weight, prefs.Weight)
+			payload.Weight = &weight
+		}
+		if payload.Height != nil {
+			height := units.ToCm(*payload.Height, prefs.Height)
+			payload.Height = &height
+		}
+	}
+
+	weight := payload.Weight
+	payload.Weight = nil
+	user, err := s.userRepository.PartialUpdate(id, version, payload)
 	if err != nil {
+		if version != nil && errors.Is(err, pgx.ErrNoRows) {
+			return nil, models.NewError(http.StatusPreconditionFailed, "Profile was modified")
+		}
+
 		return nil, err
 	}
 
+	if weight != nil {
+		if err := s.weightRecorder.RecordWeight(id, *weight); err != nil {
+			return nil, err
+		}
+		return s.userRepository.FindById(id)
+	}
+
 	return user, nil
+}
+
+// PreferredUnits returns the units the user wants to see, metric by default.
+func PreferredUnits(user *models.User) units.Preferences {
+	prefs := units.Metric
+	if user.WeightUnit.Valid {
+		prefs.Weight = user.WeightUnit.String
+	}
+	if user.HeightUnit.Valid {
+		prefs.Height = user.HeightUnit.String
+	}
+
+	return prefs
 }
\ No newline at end of file
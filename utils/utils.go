@@ -1,45 +1,125 @@
 package utils
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/jwtauth/v5"
 	"github.com/jackc/pgx/v5"
-	"golang.org/x/crypto/bcrypt"
 
 	"fit-byte/constants"
+	"fit-byte/jwtkeys"
 	"fit-byte/models"
 )
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), constants.SALT_ROUND)
-	return string(bytes), err
+// NormalizeEmail is how emails are stored and compared: two addresses only
+// differing by case are the same account.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
-func CheckPasswordHash(hash, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// GenerateToken returns a random url-safe token to be sent to a user.
+func GenerateToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashToken is how tokens are stored, so a leaked table can't be used as is.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// EncryptSecret seals plaintext with AES-GCM. key must be 32 bytes long.
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func DecryptSecret(key []byte, ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext is too short")
+	}
 
-	return err == nil
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
 }
 
-func CreateClaims(user *models.User) (string, error) {
-	tokenAuth := jwtauth.New(constants.HASH_ALG, []byte(constants.JWT_SECRET), nil)
+// CreateClaims creates the access token of user for the session sessionId,
+// valid for constants.ACCESS_TOKEN_TTL.
+func CreateClaims(keySet *jwtkeys.KeySet, user *models.User, sessionId string) (string, error) {
 	claims := map[string]any{
 		"userId":    user.Id,
 		"userEmail": user.Email,
+		"sid":       sessionId,
 	}
-	_, tokenString, err := tokenAuth.Encode(claims)
-	if err != nil {
-		return "", err
+	jwtauth.SetIssuedNow(claims)
+	jwtauth.SetExpiryIn(claims, constants.ACCESS_TOKEN_TTL)
+
+	return keySet.Sign(claims)
+}
+
+// CreateChallengeToken is handed out by a login that still needs a second
+// factor. It is only good for finishing that login, shortly.
+func CreateChallengeToken(keySet *jwtkeys.KeySet, user *models.User) (string, error) {
+	claims := map[string]any{
+		"userId":  user.Id,
+		"purpose": constants.TOKEN_PURPOSE_TWO_FACTOR_CHALLENGE,
 	}
+	jwtauth.SetIssuedNow(claims)
+	jwtauth.SetExpiryIn(claims, constants.TWO_FACTOR_CHALLENGE_TTL)
 
-	return tokenString, nil
+	return keySet.Sign(claims)
 }
 
 func SetJsonResponse(w http.ResponseWriter, statusCode int, response any) error {
@@ -96,6 +176,54 @@ func AllowContentType(contentTypes ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireAccessToken rejects tokens minted for something else than calling the
+// api, like the challenge token of a two-factor login. It must run after the
+// jwt verifier.
+func RequireAccessToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, err := jwtauth.FromContext(r.Context())
+		if err != nil || claims["purpose"] != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope lets through tokens allowed to do scope. Only personal access
+// tokens carry a "scopes" claim, login tokens can do everything.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, _ := jwtauth.FromContext(r.Context())
+			if value, restricted := claims["scopes"]; restricted {
+				scopes, _ := value.([]string)
+				if !slices.Contains(scopes, scope) {
+					http.Error(w, fmt.Sprintf("Token is missing the %s scope", scope), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectPersonalAccessTokens guards the routes managing the account itself,
+// like changing the password or creating tokens, which need a login token.
+func RejectPersonalAccessTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, _ := jwtauth.FromContext(r.Context())
+		if _, restricted := claims["scopes"]; restricted {
+			http.Error(w, "Personal access tokens can't be used here", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func GetJSONTagName(field reflect.StructField) string {
 	tag := field.Tag.Get("db")
 
@@ -105,6 +233,12 @@ func GetJSONTagName(field reflect.StructField) string {
 }
 
 func BuildPartialUpdateQuery(tableName, idField, idValue string, data interface{}) (string, pgx.NamedArgs, error) {
+	return BuildScopedPartialUpdateQuery(tableName, idField, idValue, nil, data)
+}
+
+// BuildScopedPartialUpdateQuery works like BuildPartialUpdateQuery but only
+// matches rows where every column in scope equals its value, e.g. the owner.
+func BuildScopedPartialUpdateQuery(tableName, idField, idValue string, scope map[string]any, data interface{}) (string, pgx.NamedArgs, error) {
 	val := reflect.ValueOf(data).Elem()
 	typ := reflect.TypeOf(data).Elem()
 
@@ -133,26 +267,165 @@ func BuildPartialUpdateQuery(tableName, idField, idValue string, data interface{
 		}
 	}
 
+	whereClauses := []string{fmt.Sprintf("%s = @%s", idField, idField)}
+	scopeArgs := pgx.NamedArgs{}
+	for field, value := range scope {
+		whereClauses = append(whereClauses, fmt.Sprintf("%s = @scope_%s", field, field))
+		scopeArgs["scope_"+field] = value
+	}
+	where := strings.Join(whereClauses, " AND ")
+
 	if len(setClauses) == 0 {
 		query = fmt.Sprintf(`
 		SELECT *
 		FROM %s
-		WHERE %s = @%s
-		`, tableName, idField, idField)
+		WHERE %s
+		`, tableName, where)
 		args = pgx.NamedArgs{
 			idField: idValue,
 		}
+		for k, v := range scopeArgs {
+			args[k] = v
+		}
 		return query, args, nil
 	}
 
 	query += strings.Join(setClauses, ", ")
-	query += fmt.Sprintf(" WHERE %s = @%s", idField, idField)
+	query += fmt.Sprintf(" WHERE %s", where)
 	args[idField] = idValue
+	for k, v := range scopeArgs {
+		args[k] = v
+	}
 	query += " RETURNING *"
 
 	return query, args, nil
 }
 
+// ETag is the entity tag of a resource at version. variant tells apart the
+// representations of a same version, e.g. in other units.
+func ETag(version int, variant string) string {
+	if variant == "" {
+		return fmt.Sprintf(`"%d"`, version)
+	}
+
+	return fmt.Sprintf(`"%d-%s"`, version, variant)
+}
+
+// IfMatchVersion returns the version the If-Match header expects the resource
+// to be at, nil when there is no such precondition.
+func IfMatchVersion(r *http.Request) (*int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	if strings.Contains(header, ",") {
+		return nil, models.NewError(http.StatusBadRequest, "If-Match must hold a single entity tag")
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	versionStr, _, _ := strings.Cut(tag, "-")
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		// not one of ours, it can't match
+		return nil, models.NewError(http.StatusPreconditionFailed, "Resource was modified")
+	}
+
+	return &version, nil
+}
+
+// NotModified sets the ETag header of the response and, when the If-None-Match
+// header shows the client already has this representation, answers 304 and
+// returns true.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For header is
+// believed, none by default.
+var trustedProxies []netip.Prefix
+
+// SetTrustedProxies sets the proxies allowed to tell the client ip, proxies
+// being a comma separated list of ips and CIDRs.
+func SetTrustedProxies(proxies string) error {
+	prefixes := []netip.Prefix{}
+	for _, proxy := range strings.Split(proxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	trustedProxies = prefixes
+
+	return nil
+}
+
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	return slices.ContainsFunc(trustedProxies, func(prefix netip.Prefix) bool {
+		return prefix.Contains(addr)
+	})
+}
+
+// GetClientIP returns the ip the request comes from, without the port. When
+// it comes through trusted proxies, it is the last ip of X-Forwarded-For that
+// isn't one of them, the ones before it could be made up by the client.
+func GetClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if _, err := netip.ParseAddr(ip); err != nil {
+			break
+		}
+		host = ip
+		if !isTrustedProxy(ip) {
+			break
+		}
+	}
+
+	return host
+}
+
 func IsValidHost(host string) bool {
 	return strings.Count(host, ".") > 0
 }
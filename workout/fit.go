@@ -0,0 +1,486 @@
+package workout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// FIT timestamps count seconds since 1989-12-31T00:00:00Z.
+const fitEpoch = 631065600
+
+// global message numbers from the FIT profile
+const (
+	fitMesgSession uint16 = 18
+	fitMesgLap     uint16 = 19
+	fitMesgRecord  uint16 = 20
+)
+
+// fields common to all messages, and those of sessions, laps and records
+const (
+	fitFieldTimestamp byte = 253
+
+	fitSessionStartTime        byte = 2
+	fitSessionSport            byte = 5
+	fitSessionSubSport         byte = 6
+	fitSessionTotalElapsedTime byte = 7
+	fitSessionTotalTimerTime   byte = 8
+	fitSessionTotalDistance    byte = 9
+	fitSessionTotalCalories    byte = 11
+	fitSessionAvgHeartRate     byte = 16
+	fitSessionTotalAscent      byte = 22
+
+	fitLapStartTime        byte = 2
+	fitLapTotalElapsedTime byte = 7
+	fitLapTotalTimerTime   byte = 8
+	fitLapTotalDistance    byte = 9
+	fitLapTotalCalories    byte = 11
+	fitLapAvgHeartRate     byte = 15
+	fitLapTotalAscent      byte = 21
+
+	fitRecordLatitude         byte = 0
+	fitRecordLongitude        byte = 1
+	fitRecordAltitude         byte = 2
+	fitRecordHeartRate        byte = 3
+	fitRecordPower            byte = 7
+	fitRecordEnhancedAltitude byte = 78
+)
+
+// fitSports names the sports and sub sports of the FIT profile the way
+// ActivityType understands them. Sub sports are more precise and win.
+var (
+	fitSports = map[int64]string{
+		1:  "running",
+		2:  "cycling",
+		5:  "swimming",
+		11: "walking",
+		17: "hiking",
+		62: "hiit",
+	}
+	fitSubSports = map[int64]string{
+		19: "stretching", // flexibility_training
+		43: "yoga",
+	}
+)
+
+type fitField struct {
+	num      byte
+	size     byte
+	baseType byte
+}
+
+type fitDefinition struct {
+	global      uint16
+	order       binary.ByteOrder
+	fields      []fitField
+	devDataSize int
+}
+
+// fitMessage holds the integer fields of a data message that are set.
+type fitMessage struct {
+	global uint16
+	values map[byte]int64
+}
+
+func (m fitMessage) value(field byte) (int64, bool) {
+	value, ok := m.values[field]
+	return value, ok
+}
+
+// ParseFIT reads a FIT activity file, one workout per session. Files without
+// sessions are read as a single workout made of their laps.
+func ParseFIT(r io.Reader) ([]*Workout, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := decodeFIT(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FIT file: %w", err)
+	}
+
+	var sessions, laps, records []fitMessage
+	for _, message := range messages {
+		switch message.global {
+		case fitMesgSession:
+			sessions = append(sessions, message)
+		case fitMesgLap:
+			laps = append(laps, message)
+		case fitMesgRecord:
+			records = append(records, message)
+		}
+	}
+
+	var workouts []*Workout
+	if len(sessions) == 0 {
+		w := fitLapsWorkout(laps)
+		w.Points = fitPoints(records, time.Time{}, time.Time{})
+		workouts = append(workouts, w)
+	}
+	for _, session := range sessions {
+		w, end := fitSessionWorkout(session)
+		w.Points = fitPoints(records, w.StartedAt, end)
+		workouts = append(workouts, w)
+	}
+
+	for _, w := range workouts {
+		if err := w.complete(); err != nil {
+			return nil, fmt.Errorf("invalid FIT file: %w", err)
+		}
+	}
+
+	return workouts, nil
+}
+
+func fitTime(value int64) time.Time {
+	return time.Unix(value+fitEpoch, 0).UTC()
+}
+
+// fitSeconds reads the times FIT stores in milliseconds.
+func fitSeconds(value int64) time.Duration {
+	return time.Duration(value) * time.Millisecond
+}
+
+// fitSessionWorkout reads the totals of a session, and returns when it ended
+// to tell its records apart from the other sessions'.
+func fitSessionWorkout(session fitMessage) (*Workout, time.Time) {
+	w := &Workout{}
+	if sport, ok := session.value(fitSessionSport); ok {
+		w.Sport = fitSports[sport]
+	}
+	if subSport, ok := session.value(fitSessionSubSport); ok && fitSubSports[subSport] != "" {
+		w.Sport = fitSubSports[subSport]
+	}
+
+	elapsed, _ := session.value(fitSessionTotalElapsedTime)
+	if timer, ok := session.value(fitSessionTotalTimerTime); ok {
+		w.Duration = fitSeconds(timer)
+	} else {
+		w.Duration = fitSeconds(elapsed)
+	}
+	if startTime, ok := session.value(fitSessionStartTime); ok {
+		w.StartedAt = fitTime(startTime)
+	} else if timestamp, ok := session.value(fitFieldTimestamp); ok {
+		w.StartedAt = fitTime(timestamp).Add(-fitSeconds(elapsed))
+	}
+	if distance, ok := session.value(fitSessionTotalDistance); ok {
+		w.DistanceInMeters = float64(distance) / 100
+	}
+	if ascent, ok := session.value(fitSessionTotalAscent); ok {
+		w.ElevationGainInMeters = float64(ascent)
+	}
+	if heartRate, ok := session.value(fitSessionAvgHeartRate); ok {
+		w.AverageHeartRate = int(heartRate)
+	}
+	if calories, ok := session.value(fitSessionTotalCalories); ok {
+		w.Calories = int(calories)
+	}
+
+	end := time.Time{}
+	if !w.StartedAt.IsZero() {
+		end = w.StartedAt.Add(fitSeconds(elapsed))
+	}
+
+	return w, end
+}
+
+// fitLapsWorkout sums the totals of the laps, the sport being unknown.
+func fitLapsWorkout(laps []fitMessage) *Workout {
+	w := &Workout{}
+	var heartRateSeconds, weightedHeartRate float64
+	for _, lap := range laps {
+		if startTime, ok := lap.value(fitLapStartTime); ok {
+			if start := fitTime(startTime); w.StartedAt.IsZero() || start.Before(w.StartedAt) {
+				w.StartedAt = start
+			}
+		}
+		lapDuration, ok := lap.value(fitLapTotalTimerTime)
+		if !ok {
+			lapDuration, _ = lap.value(fitLapTotalElapsedTime)
+		}
+		w.Duration += fitSeconds(lapDuration)
+		if distance, ok := lap.value(fitLapTotalDistance); ok {
+			w.DistanceInMeters += float64(distance) / 100
+		}
+		if ascent, ok := lap.value(fitLapTotalAscent); ok {
+			w.ElevationGainInMeters += float64(ascent)
+		}
+		if calories, ok := lap.value(fitLapTotalCalories); ok {
+			w.Calories += int(calories)
+		}
+		if heartRate, ok := lap.value(fitLapAvgHeartRate); ok {
+			seconds := fitSeconds(lapDuration).Seconds()
+			heartRateSeconds += seconds
+			weightedHeartRate += float64(heartRate) * seconds
+		}
+	}
+	if heartRateSeconds > 0 {
+		w.AverageHeartRate = int(math.Round(weightedHeartRate / heartRateSeconds))
+	}
+
+	return w
+}
+
+// fitPoints turns the records between start and end into points, all of them
+// when start is zero.
+func fitPoints(records []fitMessage, start time.Time, end time.Time) []Point {
+	var points []Point
+	for _, record := range records {
+		timestamp, ok := record.value(fitFieldTimestamp)
+		if !ok {
+			continue
+		}
+		point := Point{Time: fitTime(timestamp)}
+		if !start.IsZero() && (point.Time.Before(start) || (!end.IsZero() && point.Time.After(end))) {
+			continue
+		}
+
+		latitude, hasLatitude := record.value(fitRecordLatitude)
+		longitude, hasLongitude := record.value(fitRecordLongitude)
+		if hasLatitude && hasLongitude {
+			// positions are stored in semicircles
+			latitudeDegrees := float64(latitude) * 180 / math.Pow(2, 31)
+			longitudeDegrees := float64(longitude) * 180 / math.Pow(2, 31)
+			point.Latitude, point.Longitude = &latitudeDegrees, &longitudeDegrees
+		}
+		altitude, ok := record.value(fitRecordEnhancedAltitude)
+		if !ok {
+			altitude, ok = record.value(fitRecordAltitude)
+		}
+		if ok {
+			// altitudes are stored with a scale of 5 and an offset of 500m
+			elevation := float64(altitude)/5 - 500
+			point.Elevation = &elevation
+		}
+		if heartRate, ok := record.value(fitRecordHeartRate); ok {
+			value := int(heartRate)
+			point.HeartRate = &value
+		}
+		if power, ok := record.value(fitRecordPower); ok {
+			value := int(power)
+			point.Power = &value
+		}
+		points = append(points, point)
+	}
+
+	return points
+}
+
+// decodeFIT reads the data messages of a FIT file, checking its CRC.
+func decodeFIT(data []byte) ([]fitMessage, error) {
+	if len(data) < 12 {
+		return nil, errors.New("the file is too short")
+	}
+	headerSize := int(data[0])
+	if headerSize < 12 || len(data) < headerSize || !bytes.Equal(data[8:12], []byte(".FIT")) {
+		return nil, errors.New("the header is invalid")
+	}
+	end := headerSize + int(binary.LittleEndian.Uint32(data[4:8]))
+	if len(data) < end+2 {
+		return nil, errors.New("the file is truncated")
+	}
+	if fileCRC := binary.LittleEndian.Uint16(data[end : end+2]); fileCRC != 0 && fitCRC(data[:end]) != fileCRC {
+		return nil, errors.New("the CRC doesn't match")
+	}
+
+	definitions := map[byte]*fitDefinition{}
+	var messages []fitMessage
+	var lastTimestamp int64
+	pos := headerSize
+	for pos < end {
+		header := data[pos]
+		pos++
+
+		// compressed timestamp headers carry the seconds since the last
+		// timestamp, modulo 32
+		if header&0x80 != 0 {
+			definition := definitions[(header>>5)&0x03]
+			if definition == nil {
+				return nil, errors.New("a message has no definition")
+			}
+			offset := int64(header & 0x1F)
+			timestamp := lastTimestamp&^0x1F + offset
+			if offset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+			message, size, err := readFITMessage(data[pos:end], definition)
+			if err != nil {
+				return nil, err
+			}
+			pos += size
+			message.values[fitFieldTimestamp] = timestamp
+			lastTimestamp = timestamp
+			messages = append(messages, message)
+			continue
+		}
+
+		local := header & 0x0F
+		if header&0x40 != 0 {
+			definition, size, err := readFITDefinition(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			pos += size
+			definitions[local] = definition
+			continue
+		}
+
+		definition := definitions[local]
+		if definition == nil {
+			return nil, errors.New("a message has no definition")
+		}
+		message, size, err := readFITMessage(data[pos:end], definition)
+		if err != nil {
+			return nil, err
+		}
+		pos += size
+		if timestamp, ok := message.value(fitFieldTimestamp); ok {
+			lastTimestamp = timestamp
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+func readFITDefinition(data []byte, hasDevData bool) (*fitDefinition, int, error) {
+	if len(data) < 5 {
+		return nil, 0, errors.New("a definition is truncated")
+	}
+	definition := &fitDefinition{order: binary.LittleEndian}
+	if data[1] == 1 {
+		definition.order = binary.BigEndian
+	}
+	definition.global = definition.order.Uint16(data[2:4])
+
+	fieldCount := int(data[4])
+	pos := 5
+	if len(data) < pos+fieldCount*3 {
+		return nil, 0, errors.New("a definition is truncated")
+	}
+	for i := 0; i < fieldCount; i++ {
+		definition.fields = append(definition.fields, fitField{num: data[pos], size: data[pos+1], baseType: data[pos+2]})
+		pos += 3
+	}
+
+	// developer fields are skipped, only their size matters
+	if hasDevData {
+		if len(data) < pos+1 {
+			return nil, 0, errors.New("a definition is truncated")
+		}
+		devFieldCount := int(data[pos])
+		pos++
+		if len(data) < pos+devFieldCount*3 {
+			return nil, 0, errors.New("a definition is truncated")
+		}
+		for i := 0; i < devFieldCount; i++ {
+			definition.devDataSize += int(data[pos+1])
+			pos += 3
+		}
+	}
+
+	return definition, pos, nil
+}
+
+func readFITMessage(data []byte, definition *fitDefinition) (fitMessage, int, error) {
+	message := fitMessage{global: definition.global, values: map[byte]int64{}}
+	pos := 0
+	for _, field := range definition.fields {
+		if len(data) < pos+int(field.size) {
+			return message, 0, errors.New("a message is truncated")
+		}
+		if value, ok := readFITValue(data[pos:pos+int(field.size)], field.baseType, definition.order); ok {
+			message.values[field.num] = value
+		}
+		pos += int(field.size)
+	}
+	if len(data) < pos+definition.devDataSize {
+		return message, 0, errors.New("a message is truncated")
+	}
+
+	return message, pos + definition.devDataSize, nil
+}
+
+// readFITValue reads a single integer, it returns false for the invalid value
+// of its base type and for the types that aren't needed, like strings, floats
+// and arrays.
+func readFITValue(data []byte, baseType byte, order binary.ByteOrder) (int64, bool) {
+	var value, invalid int64
+	switch baseType & 0x1F {
+	case 0x00, 0x02, 0x0D: // enum, uint8, byte
+		if len(data) != 1 {
+			return 0, false
+		}
+		value, invalid = int64(data[0]), 0xFF
+	case 0x0A: // uint8z
+		if len(data) != 1 {
+			return 0, false
+		}
+		value, invalid = int64(data[0]), 0
+	case 0x01: // sint8
+		if len(data) != 1 {
+			return 0, false
+		}
+		value, invalid = int64(int8(data[0])), 0x7F
+	case 0x03: // sint16
+		if len(data) != 2 {
+			return 0, false
+		}
+		value, invalid = int64(int16(order.Uint16(data))), 0x7FFF
+	case 0x04: // uint16
+		if len(data) != 2 {
+			return 0, false
+		}
+		value, invalid = int64(order.Uint16(data)), 0xFFFF
+	case 0x0B: // uint16z
+		if len(data) != 2 {
+			return 0, false
+		}
+		value, invalid = int64(order.Uint16(data)), 0
+	case 0x05: // sint32
+		if len(data) != 4 {
+			return 0, false
+		}
+		value, invalid = int64(int32(order.Uint32(data))), 0x7FFFFFFF
+	case 0x06: // uint32
+		if len(data) != 4 {
+			return 0, false
+		}
+		value, invalid = int64(order.Uint32(data)), 0xFFFFFFFF
+	case 0x0C: // uint32z
+		if len(data) != 4 {
+			return 0, false
+		}
+		value, invalid = int64(order.Uint32(data)), 0
+	default:
+		return 0, false
+	}
+
+	return value, value != invalid
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// fitCRC is the CRC-16 the FIT protocol ends files with.
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+
+	return crc
+}
@@ -0,0 +1,283 @@
+package workout
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The fixtures under testdata start at this time, except compressed.fit.
+var fixtureStart = time.Date(2024, 5, 4, 7, 30, 0, 0, time.UTC)
+
+func parseFixture(t *testing.T, name string) []*Workout {
+	t.Helper()
+	workouts, err := ParseFIT(bytes.NewReader(readFixture(t, name)))
+	if err != nil {
+		t.Fatalf("ParseFIT(%s): %v", name, err)
+	}
+
+	return workouts
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func heartRates(points []Point) []int {
+	var values []int
+	for _, point := range points {
+		if point.HeartRate == nil {
+			values = append(values, 0)
+			continue
+		}
+		values = append(values, *point.HeartRate)
+	}
+
+	return values
+}
+
+func powers(points []Point) []int {
+	var values []int
+	for _, point := range points {
+		if point.Power == nil {
+			values = append(values, 0)
+			continue
+		}
+		values = append(values, *point.Power)
+	}
+
+	return values
+}
+
+func TestParseFITSession(t *testing.T) {
+	workouts := parseFixture(t, "run.fit")
+	if len(workouts) != 1 {
+		t.Fatalf("got %d workouts, want 1", len(workouts))
+	}
+	w := workouts[0]
+
+	if w.Sport != "running" {
+		t.Errorf("Sport = %q, want running", w.Sport)
+	}
+	if activityType, _ := ActivityType(w.Sport); activityType != "Running" {
+		t.Errorf("ActivityType(%q) = %q, want Running", w.Sport, activityType)
+	}
+	if !w.StartedAt.Equal(fixtureStart) {
+		t.Errorf("StartedAt = %v, want %v", w.StartedAt, fixtureStart)
+	}
+	// the session was paused for a minute, the timer time leaves it out
+	if w.Duration != 9*time.Minute {
+		t.Errorf("Duration = %v, want 9m", w.Duration)
+	}
+	if w.Calories != 95 {
+		t.Errorf("Calories = %d, want 95", w.Calories)
+	}
+	if w.DistanceInMeters != 1500 {
+		t.Errorf("DistanceInMeters = %v, want 1500", w.DistanceInMeters)
+	}
+	if w.ElevationGainInMeters != 12 {
+		t.Errorf("ElevationGainInMeters = %v, want 12", w.ElevationGainInMeters)
+	}
+	if w.AverageHeartRate != 138 {
+		t.Errorf("AverageHeartRate = %d, want 138", w.AverageHeartRate)
+	}
+
+	if len(w.Points) != 5 {
+		t.Fatalf("got %d points, want 5", len(w.Points))
+	}
+	if got, want := heartRates(w.Points), []int{120, 130, 140, 150, 145}; !slices.Equal(got, want) {
+		t.Errorf("heart rates = %v, want %v", got, want)
+	}
+	if got, want := powers(w.Points), []int{200, 210, 220, 230, 225}; !slices.Equal(got, want) {
+		t.Errorf("powers = %v, want %v", got, want)
+	}
+	for i, point := range w.Points {
+		if want := fixtureStart.Add(time.Duration(i) * time.Minute); !point.Time.Equal(want) {
+			t.Errorf("point %d Time = %v, want %v", i, point.Time, want)
+		}
+	}
+	first := w.Points[0]
+	if first.Latitude == nil || first.Longitude == nil || first.Elevation == nil {
+		t.Fatalf("the first point has no position: %+v", first)
+	}
+	if math.Abs(*first.Latitude-52.52) > 1e-6 || math.Abs(*first.Longitude-13.405) > 1e-6 {
+		t.Errorf("position = %v,%v, want 52.52,13.405", *first.Latitude, *first.Longitude)
+	}
+	if *first.Elevation != 34 {
+		t.Errorf("Elevation = %v, want 34", *first.Elevation)
+	}
+}
+
+func TestParseFITMultisport(t *testing.T) {
+	workouts := parseFixture(t, "multisport.fit")
+	if len(workouts) != 2 {
+		t.Fatalf("got %d workouts, want 2", len(workouts))
+	}
+	ride, run := workouts[0], workouts[1]
+
+	if ride.Sport != "cycling" || run.Sport != "running" {
+		t.Errorf("sports = %q, %q, want cycling, running", ride.Sport, run.Sport)
+	}
+	if !ride.StartedAt.Equal(fixtureStart) {
+		t.Errorf("ride StartedAt = %v, want %v", ride.StartedAt, fixtureStart)
+	}
+	if want := fixtureStart.Add(25 * time.Minute); !run.StartedAt.Equal(want) {
+		t.Errorf("run StartedAt = %v, want %v", run.StartedAt, want)
+	}
+	if ride.Duration != 20*time.Minute || run.Duration != 10*time.Minute {
+		t.Errorf("durations = %v, %v, want 20m, 10m", ride.Duration, run.Duration)
+	}
+	if ride.Calories != 300 || run.Calories != 150 {
+		t.Errorf("calories = %d, %d, want 300, 150", ride.Calories, run.Calories)
+	}
+
+	// each session only gets the records taken while it lasted
+	if got, want := heartRates(ride.Points), []int{110, 125, 130}; !slices.Equal(got, want) {
+		t.Errorf("ride heart rates = %v, want %v", got, want)
+	}
+	if got, want := heartRates(run.Points), []int{140, 150, 155}; !slices.Equal(got, want) {
+		t.Errorf("run heart rates = %v, want %v", got, want)
+	}
+	// the run was recorded without a power meter
+	for _, point := range run.Points {
+		if point.Power != nil {
+			t.Errorf("run point at %v has power %d, want none", point.Time, *point.Power)
+		}
+	}
+}
+
+func TestParseFITLaps(t *testing.T) {
+	workouts := parseFixture(t, "laps.fit")
+	if len(workouts) != 1 {
+		t.Fatalf("got %d workouts, want 1", len(workouts))
+	}
+	w := workouts[0]
+
+	if w.Sport != "" {
+		t.Errorf("Sport = %q, want none", w.Sport)
+	}
+	if !w.StartedAt.Equal(fixtureStart) {
+		t.Errorf("StartedAt = %v, want %v", w.StartedAt, fixtureStart)
+	}
+	if w.Duration != 15*time.Minute {
+		t.Errorf("Duration = %v, want 15m", w.Duration)
+	}
+	if w.DistanceInMeters != 3000 {
+		t.Errorf("DistanceInMeters = %v, want 3000", w.DistanceInMeters)
+	}
+	if w.Calories != 120 {
+		t.Errorf("Calories = %d, want 120", w.Calories)
+	}
+	if w.ElevationGainInMeters != 7 {
+		t.Errorf("ElevationGainInMeters = %v, want 7", w.ElevationGainInMeters)
+	}
+	// weighted by the time of each lap: (130*5 + 145*10) / 15
+	if w.AverageHeartRate != 140 {
+		t.Errorf("AverageHeartRate = %d, want 140", w.AverageHeartRate)
+	}
+	if len(w.Points) != 0 {
+		t.Errorf("got %d points, want none", len(w.Points))
+	}
+}
+
+func TestParseFITCompressedTimestamps(t *testing.T) {
+	workouts := parseFixture(t, "compressed.fit")
+	if len(workouts) != 1 {
+		t.Fatalf("got %d workouts, want 1", len(workouts))
+	}
+	w := workouts[0]
+
+	if len(w.Points) != 4 {
+		t.Fatalf("got %d points, want 4", len(w.Points))
+	}
+	// the offsets roll over between the second and third records
+	start := w.Points[0].Time
+	if !start.Equal(w.StartedAt) {
+		t.Errorf("first point at %v, want the start %v", start, w.StartedAt)
+	}
+	for i, seconds := range []int{0, 2, 5, 10} {
+		if want := start.Add(time.Duration(seconds) * time.Second); !w.Points[i].Time.Equal(want) {
+			t.Errorf("point %d Time = %v, want %v", i, w.Points[i].Time, want)
+		}
+	}
+	if got, want := heartRates(w.Points), []int{100, 105, 110, 115}; !slices.Equal(got, want) {
+		t.Errorf("heart rates = %v, want %v", got, want)
+	}
+	if got, want := powers(w.Points), []int{150, 155, 160, 165}; !slices.Equal(got, want) {
+		t.Errorf("powers = %v, want %v", got, want)
+	}
+}
+
+func TestParseFITDeveloperFields(t *testing.T) {
+	workouts := parseFixture(t, "devfields.fit")
+	if len(workouts) != 1 {
+		t.Fatalf("got %d workouts, want 1", len(workouts))
+	}
+	w := workouts[0]
+
+	if w.Sport != "running" || w.Duration != 2*time.Minute || w.Calories != 30 {
+		t.Errorf("got %q for %v and %d calories, want running for 2m and 30 calories", w.Sport, w.Duration, w.Calories)
+	}
+	// the developer data following each record is skipped, not read as the
+	// next message
+	if got, want := heartRates(w.Points), []int{135, 140, 145}; !slices.Equal(got, want) {
+		t.Errorf("heart rates = %v, want %v", got, want)
+	}
+	if got, want := powers(w.Points), []int{240, 250, 260}; !slices.Equal(got, want) {
+		t.Errorf("powers = %v, want %v", got, want)
+	}
+}
+
+func TestParseFITCorrupted(t *testing.T) {
+	for _, name := range []string{"bad_crc.fit", "truncated.fit"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseFIT(bytes.NewReader(readFixture(t, name))); err == nil {
+				t.Error("ParseFIT succeeded, want an error")
+			}
+		})
+	}
+
+	// a file cut anywhere is missing its CRC, at least
+	data := readFixture(t, "run.fit")
+	for size := 0; size < len(data); size++ {
+		if _, err := ParseFIT(bytes.NewReader(data[:size])); err == nil {
+			t.Errorf("ParseFIT of the first %d bytes succeeded, want an error", size)
+		}
+	}
+}
+
+// TestParseFITNoPanic checks that cut or damaged messages are reported rather
+// than read out of bounds, the CRC being left out as decoders allow.
+func TestParseFITNoPanic(t *testing.T) {
+	data := readFixture(t, "devfields.fit")
+	headerSize := int(data[0])
+	body := data[headerSize : len(data)-2]
+
+	withoutCRC := func(body []byte) []byte {
+		file := append([]byte{}, data[:headerSize]...)
+		file[4], file[5], file[6], file[7] = byte(len(body)), byte(len(body)>>8), byte(len(body)>>16), byte(len(body)>>24)
+		file = append(file, body...)
+		return append(file, 0, 0)
+	}
+
+	for size := 0; size < len(body); size++ {
+		ParseFIT(bytes.NewReader(withoutCRC(body[:size])))
+	}
+	for i := range body {
+		for _, b := range []byte{0x00, 0x40, 0x60, 0xFF} {
+			damaged := append([]byte{}, body...)
+			damaged[i] = b
+			ParseFIT(bytes.NewReader(withoutCRC(damaged)))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package workout
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type gpxFile struct {
+	Metadata struct {
+		Time *time.Time `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []struct {
+				Latitude   float64    `xml:"lat,attr"`
+				Longitude  float64    `xml:"lon,attr"`
+				Elevation  *float64   `xml:"ele"`
+				Time       *time.Time `xml:"time"`
+				Extensions struct {
+					// Garmin's TrackPointExtension, whatever the prefix
+					HeartRate *int `xml:"TrackPointExtension>hr"`
+				} `xml:"extensions"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ParseGPX reads a GPX 1.1 file. Its track points need a time, the sport is
+// the first track's type.
+func ParseGPX(r io.Reader) (*Workout, error) {
+	var file gpxFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid GPX file: %w", err)
+	}
+
+	w := &Workout{}
+	for _, track := range file.Tracks {
+		if w.Sport == "" {
+			w.Sport = track.Type
+		}
+		for _, segment := range track.Segments {
+			for _, trackPoint := range segment.Points {
+				if trackPoint.Time == nil {
+					continue
+				}
+				latitude, longitude := trackPoint.Latitude, trackPoint.Longitude
+				w.Points = append(w.Points, Point{
+					Time:      trackPoint.Time.UTC(),
+					Latitude:  &latitude,
+					Longitude: &longitude,
+					Elevation: trackPoint.Elevation,
+					HeartRate: trackPoint.Extensions.HeartRate,
+				})
+			}
+		}
+	}
+	sort.SliceStable(w.Points, func(i, j int) bool { return w.Points[i].Time.Before(w.Points[j].Time) })
+	if len(w.Points) == 0 && file.Metadata.Time != nil {
+		w.StartedAt = file.Metadata.Time.UTC()
+	}
+
+	if err := w.complete(); err != nil {
+		return nil, fmt.Errorf("invalid GPX file: %w", err)
+	}
+
+	return w, nil
+}
@@ -0,0 +1,75 @@
+package workout
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		Laps  []struct {
+			StartTime        time.Time `xml:"StartTime,attr"`
+			TotalTimeSeconds float64   `xml:"TotalTimeSeconds"`
+			DistanceMeters   float64   `xml:"DistanceMeters"`
+			AverageHeartRate *int      `xml:"AverageHeartRateBpm>Value"`
+			Points           []struct {
+				Time      time.Time `xml:"Time"`
+				Latitude  *float64  `xml:"Position>LatitudeDegrees"`
+				Longitude *float64  `xml:"Position>LongitudeDegrees"`
+				Elevation *float64  `xml:"AltitudeMeters"`
+				HeartRate *int      `xml:"HeartRateBpm>Value"`
+			} `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+// ParseTCX reads the first activity of a Garmin Training Center file. The
+// totals are summed from its laps.
+func ParseTCX(r io.Reader) (*Workout, error) {
+	var file tcxFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid TCX file: %w", err)
+	}
+	if len(file.Activities) == 0 {
+		return nil, fmt.Errorf("invalid TCX file: it has no activity")
+	}
+
+	activity := file.Activities[0]
+	w := &Workout{Sport: activity.Sport}
+	var seconds, heartRateSeconds, weightedHeartRate float64
+	for _, lap := range activity.Laps {
+		if w.StartedAt.IsZero() || lap.StartTime.Before(w.StartedAt) {
+			w.StartedAt = lap.StartTime.UTC()
+		}
+		seconds += lap.TotalTimeSeconds
+		w.DistanceInMeters += lap.DistanceMeters
+		if lap.AverageHeartRate != nil {
+			heartRateSeconds += lap.TotalTimeSeconds
+			weightedHeartRate += float64(*lap.AverageHeartRate) * lap.TotalTimeSeconds
+		}
+
+		for _, trackPoint := range lap.Points {
+			w.Points = append(w.Points, Point{
+				Time:      trackPoint.Time.UTC(),
+				Latitude:  trackPoint.Latitude,
+				Longitude: trackPoint.Longitude,
+				Elevation: trackPoint.Elevation,
+				HeartRate: trackPoint.HeartRate,
+			})
+		}
+	}
+	w.Duration = time.Duration(seconds * float64(time.Second))
+	if heartRateSeconds > 0 {
+		w.AverageHeartRate = int(math.Round(weightedHeartRate / heartRateSeconds))
+	}
+
+	if err := w.complete(); err != nil {
+		return nil, fmt.Errorf("invalid TCX file: %w", err)
+	}
+
+	return w, nil
+}
@@ -0,0 +1,192 @@
+// Package workout reads the workouts recorded by watches and bike computers
+// from the files they export.
+package workout
+
+import (
+	"errors"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported workout file format")
+
+// Workout is what a file tells about a workout. Totals are taken from the
+// file when it has them and derived from the points otherwise, zero meaning
+// unknown.
+type Workout struct {
+	// Sport is the file's own name for it, see ActivityType.
+	Sport                 string
+	StartedAt             time.Time
+	Duration              time.Duration
+	DistanceInMeters      float64
+	ElevationGainInMeters float64
+	AverageHeartRate      int
+	// Calories is the energy the device reckoned was burned.
+	Calories int
+	Points   []Point
+}
+
+// Point is a sample of the track, fields a device didn't record are nil.
+type Point struct {
+	Time      time.Time
+	Latitude  *float64
+	Longitude *float64
+	Elevation *float64
+	HeartRate *int
+	Power     *int
+}
+
+// Parse reads the workouts in the file named name, the format being told by
+// its extension. Only FIT files hold more than one.
+func Parse(name string, r io.Reader) ([]*Workout, error) {
+	var w *Workout
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gpx":
+		w, err = ParseGPX(r)
+	case ".tcx":
+		w, err = ParseTCX(r)
+	case ".fit":
+		return ParseFIT(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Workout{w}, nil
+}
+
+// ActivityType maps a sport as named in workout files to one of the activity
+// types, it returns false when none fits.
+func ActivityType(sport string) (string, bool) {
+	sport = strings.ToLower(sport)
+	switch {
+	case strings.Contains(sport, "run"):
+		return "Running", true
+	case strings.Contains(sport, "bik"), strings.Contains(sport, "cycl"), strings.Contains(sport, "ride"):
+		return "Cycling", true
+	case strings.Contains(sport, "walk"):
+		return "Walking", true
+	case strings.Contains(sport, "hik"):
+		return "Hiking", true
+	case strings.Contains(sport, "swim"):
+		return "Swimming", true
+	case strings.Contains(sport, "yoga"):
+		return "Yoga", true
+	case strings.Contains(sport, "danc"):
+		return "Dancing", true
+	case strings.Contains(sport, "hiit"), strings.Contains(sport, "interval"):
+		return "HIIT", true
+	case strings.Contains(sport, "rope"):
+		return "JumpRope", true
+	case strings.Contains(sport, "stretch"), strings.Contains(sport, "flexib"):
+		return "Stretching", true
+	}
+
+	return "", false
+}
+
+// complete fills in the totals the file didn't have from the points.
+func (w *Workout) complete() error {
+	if len(w.Points) == 0 && w.Duration == 0 {
+		return errors.New("the workout has neither a track nor a duration")
+	}
+
+	if len(w.Points) > 0 {
+		first, last := w.Points[0], w.Points[len(w.Points)-1]
+		if w.StartedAt.IsZero() {
+			w.StartedAt = first.Time
+		}
+		if w.Duration == 0 {
+			w.Duration = last.Time.Sub(first.Time)
+		}
+	}
+	if w.StartedAt.IsZero() {
+		return errors.New("the workout has no start time")
+	}
+	if w.DistanceInMeters == 0 {
+		w.DistanceInMeters = trackDistance(w.Points)
+	}
+	if w.ElevationGainInMeters == 0 {
+		w.ElevationGainInMeters = elevationGain(w.Points)
+	}
+	if w.AverageHeartRate == 0 {
+		w.AverageHeartRate = averageHeartRate(w.Points)
+	}
+
+	return nil
+}
+
+const earthRadiusInMeters = 6371000
+
+// haversine is the distance between two coordinates in meters.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusInMeters * math.Asin(math.Sqrt(a))
+}
+
+func trackDistance(points []Point) float64 {
+	var distance float64
+	var previous *Point
+	for i := range points {
+		point := &points[i]
+		if point.Latitude == nil || point.Longitude == nil {
+			continue
+		}
+		if previous != nil {
+			distance += haversine(*previous.Latitude, *previous.Longitude, *point.Latitude, *point.Longitude)
+		}
+		previous = point
+	}
+
+	return distance
+}
+
+// elevationGainThreshold ignores the climbs smaller than the noise of GPS
+// and barometric altimeters.
+const elevationGainThreshold = 2.0
+
+func elevationGain(points []Point) float64 {
+	var gain float64
+	var reference *float64
+	for _, point := range points {
+		if point.Elevation == nil {
+			continue
+		}
+		if reference == nil || *point.Elevation < *reference {
+			reference = point.Elevation
+			continue
+		}
+		if climb := *point.Elevation - *reference; climb >= elevationGainThreshold {
+			gain += climb
+			reference = point.Elevation
+		}
+	}
+
+	return gain
+}
+
+func averageHeartRate(points []Point) int {
+	var sum, count int
+	for _, point := range points {
+		if point.HeartRate != nil && *point.HeartRate > 0 {
+			sum += *point.HeartRate
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+
+	return int(math.Round(float64(sum) / float64(count)))
+}